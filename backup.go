@@ -0,0 +1,80 @@
+package boltqueue
+
+import (
+	"io"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// Backup writes a consistent copy of the queue's database to w, returning the number of
+// bytes written. The queue remains usable meanwhile; the copy includes every change that
+// had been committed when the backup began, and none after. For named queues, the whole
+// database is copied, including any other queues.
+func (b *PQueue) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := b.view(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// SnapshotTo writes a consistent copy of the queue's database to a new file, as for Backup.
+// The file can be opened using NewPQueue or RestoreFrom.
+func (b *PQueue) SnapshotTo(path string) error {
+	return b.view(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+// RestoreFrom creates a queue from a copy made by Backup or SnapshotTo, which is not itself
+// altered. The copy is written to the given filename, which must not already exist; as for
+// NewPQueue, if it is a directory name ending with '/', a unique filename is generated and
+// appended to it. The number of priorities is the number recorded in the copy.
+// Nil options are the same as the zero value.
+func RestoreFrom(snapshot, filename string, opts *Options) (*PQueue, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	filename = opts.filename(filename)
+	if err := copyFile(snapshot, filename, opts.fileMode()); err != nil {
+		return nil, err
+	}
+
+	q, err := NewPQueueWithOptions(filename, 0, opts)
+	if err != nil {
+		os.Remove(filename)
+		return nil, err
+	}
+	return q, nil
+}
+
+// copyFile copies a file to a new file, which is synced to disk.
+func copyFile(from, to string, mode os.FileMode) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(to)
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package boltqueue
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func populate(t *testing.T, pq *PQueue) {
+	t.Helper()
+	for n := 1; n <= 3; n++ {
+		for p := zero; p <= five; p++ {
+			m := NewMessagef("test message %d-%d", p, n).WithHeader("n", fmt.Sprint(n))
+			if err := pq.Enqueue(p, m); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	pq.EnqueueAfter(one, time.Hour, NewMessage("later"))
+}
+
+func drain(t *testing.T, pq *PQueue) []string {
+	t.Helper()
+	var list []string
+	for m, err := range pq.Drain() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, fmt.Sprintf("%d %d %s %s", m.ID(), m.Priority(), m.String(), m.Header("n")))
+	}
+	return list
+}
+
+func assertSameOrder(t *testing.T, expected, got []string) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d messages. Got: %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected[i], got[i])
+		}
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	populate(t, testPQueue)
+
+	defer os.Remove("testSnapshot.db")
+	if err = testPQueue.SnapshotTo("testSnapshot.db"); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := RestoreFrom("testSnapshot.db", "./", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if s, _ := restored.ScheduledSize(); s != 1 {
+		t.Errorf("Expected 1 scheduled message. Got: %d", s)
+	}
+	assertSameOrder(t, drain(t, testPQueue), drain(t, restored))
+
+	// the snapshot itself is left alone
+	if _, err = RestoreFrom("testSnapshot.db", restored.conn.Path(), nil); err == nil {
+		t.Error("Expected an error when restoring over an existing file")
+	}
+}
+
+func TestBackupWhileInUse(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	populate(t, testPQueue)
+
+	// producers carry on during the backup
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			testPQueue.EnqueueString(zero, "more")
+		}
+	}()
+
+	buf := &bytes.Buffer{}
+	if _, err = testPQueue.Backup(buf); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	defer os.Remove("testBackup.db")
+	if err = os.WriteFile("testBackup.db", buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := RestoreFrom("testBackup.db", "./", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	// the backup is consistent, whenever it was taken
+	n, _ := restored.Len()
+	expected := drain(t, testPQueue)[:n]
+	assertSameOrder(t, expected, drain(t, restored))
+}
@@ -0,0 +1,100 @@
+package boltqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// EnqueueBatch adds several messages to the queue at a specified priority (0=lowest), in
+// order. This is much faster than enqueueing them separately because they are all stored
+// in one transaction. Either all of the messages are stored or, on error, none of them are.
+// The messages' IDs are set when they have been stored. If the queue does not have room for
+// all of the messages, the Overflow policy applies to them together.
+func (b *PQueue) EnqueueBatch(priority uint, messages []*Message) error {
+	ipri := int64(priority)
+	if ipri > b.maxPriority {
+		return fmt.Errorf("Invalid priority %d on EnqueueBatch", priority)
+	}
+
+	now := time.Now()
+	var size int64
+	for _, m := range messages {
+		m.stamp(now)
+		size += int64(len(m.value))
+	}
+
+	keys := make([][]byte, len(messages))
+	err := b.whenRoom(context.Background(), func() error {
+		return b.write(func(tx *bbolt.Tx) error {
+			clear(keys)
+			ok, err := b.makeRoom(tx, int64(len(messages)), size)
+			if !ok || err != nil {
+				return err
+			}
+
+			for i, m := range messages {
+				key, err := b.nextKey(tx)
+				if err != nil {
+					return err
+				}
+				if err = b.put(tx, ipri, key, m); err != nil {
+					return err
+				}
+				keys[i] = key
+			}
+			return nil
+		})
+	})
+
+	if err == nil {
+		for i, m := range messages {
+			if keys[i] != nil {
+				m.key = keys[i]
+			}
+		}
+	}
+	return err
+}
+
+// EnqueueValues adds several byte slice values to the queue at a specified priority (0=lowest),
+// in order, as for EnqueueBatch.
+func (b *PQueue) EnqueueValues(priority uint, values [][]byte) error {
+	messages := make([]*Message, len(values))
+	for i, v := range values {
+		messages[i] = WrapBytes(v)
+	}
+	return b.EnqueueBatch(priority, messages)
+}
+
+// DequeueN removes up to n of the oldest, highest priority messages from the queue and
+// returns them in order. This is much faster than dequeueing them separately because they
+// are all removed in one transaction. Either all of the messages are removed or, on error,
+// none of them are.
+// If there are no messages available, the result is empty.
+func (b *PQueue) DequeueN(n int) ([]*Message, error) {
+	var list []*Message
+
+	err := b.update(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		if err := b.housekeep(tx, now); err != nil {
+			return err
+		}
+
+		for len(list) < n {
+			m, err := b.take(tx, now)
+			if m == nil || err != nil {
+				return err
+			}
+			list = append(list, m)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
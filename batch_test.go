@@ -0,0 +1,101 @@
+package boltqueue
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEnqueueBatchDequeueN(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	for p := one; p <= five; p++ {
+		var batch []*Message
+		for n := 1; n <= 10; n++ {
+			batch = append(batch, NewMessagef("test message %d-%d", p, n))
+		}
+		err := testPQueue.EnqueueBatch(p, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if testPQueue.ApproxSize() != 50 {
+		t.Errorf("Expected total size 50. Got: %d", testPQueue.ApproxSize())
+	}
+
+	list, err := testPQueue.DequeueN(15)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(list) != 15 {
+		t.Fatalf("Expected 15 messages. Got: %d", len(list))
+	}
+
+	for i, m := range list {
+		p, n := 5-uint(i/10), i%10+1
+		mStrComp := fmt.Sprintf("test message %d-%d", p, n)
+		if m.String() != mStrComp || m.Priority() != p {
+			t.Errorf("Expected message: \"%s\" at %d, got: \"%s\" at %d", mStrComp, p, m.String(), m.Priority())
+		}
+	}
+
+	list, err = testPQueue.DequeueN(100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(list) != 35 {
+		t.Errorf("Expected 35 messages. Got: %d", len(list))
+	}
+
+	if testPQueue.ApproxSize() != 0 {
+		t.Errorf("Expected total size 0. Got: %d", testPQueue.ApproxSize())
+	}
+}
+
+func TestEnqueueBatchInvalidPriority(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	err = testPQueue.EnqueueValues(10, [][]byte{[]byte("a"), []byte("b")})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+	if s, _ := testPQueue.TotalSize(); s != 0 {
+		t.Errorf("Expected total size 0. Got: %d", s)
+	}
+}
+
+func benchmarkEnqueueBatch(b *testing.B, batchSize int) {
+	queue, err := NewPQueue("./", 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer queue.Close()
+
+	batch := make([][]byte, batchSize)
+	for i := range batch {
+		batch[i] = []byte("test message")
+	}
+
+	for n := 0; n < b.N; n++ {
+		if err := queue.EnqueueValues(0, batch); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := queue.DequeueN(batchSize); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEnqueueBatch1(b *testing.B) {
+	benchmarkEnqueueBatch(b, 1)
+}
+
+func BenchmarkEnqueueBatch100(b *testing.B) {
+	benchmarkEnqueueBatch(b, 100)
+}
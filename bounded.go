@@ -0,0 +1,146 @@
+package boltqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrQueueFull is returned when a message cannot be enqueued because the queue has reached
+// its MaxMessages or MaxBytes limit.
+var ErrQueueFull = errors.New("Queue is full.")
+
+// ErrTooLarge is returned when messages could never be enqueued, because together they
+// exceed the queue's MaxMessages or MaxBytes limit. It is also an ErrQueueFull.
+var ErrTooLarge = fmt.Errorf("%w The messages exceed the queue's limits.", ErrQueueFull)
+
+// OverflowPolicy determines what happens when a message is enqueued into a queue that has
+// reached its limit.
+type OverflowPolicy int
+
+const (
+	// Reject fails the enqueue with ErrQueueFull. This is the default.
+	Reject OverflowPolicy = iota
+
+	// Block waits until consumers have made enough room. EnqueueContext allows the wait
+	// to be cancelled; otherwise it ends only when the queue is closed. Messages that
+	// could never fit fail at once with ErrTooLarge.
+	Block
+
+	// DropOldest discards the oldest messages of the lowest priority to make room.
+	DropOldest
+
+	// DropNewest silently discards the message being enqueued.
+	DropNewest
+)
+
+// EnqueueContext adds a message to the queue at a specified priority (0=lowest), as for
+// Enqueue. If the queue is full and its OverflowPolicy is Block, this waits until there is
+// room or the context is cancelled, in which case the context's error is returned.
+func (b *PQueue) EnqueueContext(ctx context.Context, priority uint, message *Message) error {
+	return b.enqueueContext(ctx, priority, message)
+}
+
+// whenRoom runs a write of new messages, which fails with ErrQueueFull if there is no room
+// for them. If the policy is Block, the write is retried whenever messages are removed,
+// until it succeeds or the context is done, unless there could never be room.
+func (b *PQueue) whenRoom(ctx context.Context, write func() error) error {
+	for {
+		// obtained beforehand so that no removals are missed
+		removed := b.space.wait()
+
+		err := write()
+		if b.Overflow != Block || !errors.Is(err, ErrQueueFull) || errors.Is(err, ErrTooLarge) {
+			return err
+		}
+
+		select {
+		case <-removed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.closing:
+			return ErrClosed
+		}
+	}
+}
+
+// makeRoom checks that n new messages, with values totalling size bytes, fit within the
+// queue's limits, within an Update transaction. Depending on the policy, it may remove
+// messages to make room. It returns false if the new messages should be discarded instead.
+func (b *PQueue) makeRoom(tx *bbolt.Tx, n, size int64) (bool, error) {
+	if b.MaxMessages <= 0 && b.MaxBytes <= 0 {
+		return true, nil
+	}
+
+	fits := func(n, size int64) bool {
+		return (b.MaxMessages <= 0 || n <= b.MaxMessages) && (b.MaxBytes <= 0 || size <= b.MaxBytes)
+	}
+
+	if !fits(n, size) {
+		// there would never be room
+		if b.Overflow == DropNewest {
+			return false, nil
+		}
+		return false, ErrTooLarge
+	}
+
+	var total, bytes int64
+	if mb := b.bucket(tx, metaBucket); mb != nil {
+		total, bytes = int64(getUint64(mb.Get(totalKey))), int64(getUint64(mb.Get(bytesKey)))
+	}
+
+	for !fits(total+n, bytes+size) {
+		switch b.Overflow {
+		case DropNewest:
+			return false, nil
+
+		case DropOldest:
+			m, err := b.dropOldest(tx)
+			if m == nil || err != nil {
+				return false, err
+			}
+			total--
+			bytes -= int64(len(m.value))
+
+		default:
+			return false, ErrQueueFull
+		}
+	}
+	return true, nil
+}
+
+// dropOldest removes the oldest message of the lowest priority, within an Update transaction.
+func (b *PQueue) dropOldest(tx *bbolt.Tx) (*Message, error) {
+	cb := b.counts(tx)
+	if cb == nil {
+		return nil, nil
+	}
+
+	k, _ := cb.Cursor().First()
+	if k == nil {
+		return nil, nil
+	}
+
+	pri := priFromBytes(k)
+	pb := b.bucket(tx, priBytes(pri, b.maxPriority))
+	if pb == nil {
+		return nil, nil
+	}
+
+	cur := pb.Cursor()
+	k, v := cur.First()
+	if k == nil {
+		return nil, nil
+	}
+
+	m, err := decodeMessage(uint(pri), k, v)
+	if err != nil {
+		return nil, err
+	}
+	if err = cur.Delete(); err != nil {
+		return nil, err
+	}
+	return m, b.dropped(tx, m)
+}
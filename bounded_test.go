@@ -0,0 +1,226 @@
+package boltqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRejectWhenFull(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	testPQueue.MaxMessages = 2
+	testPQueue.MaxBytes = 20
+
+	testPQueue.EnqueueString(one, "0123456789")
+	if err = testPQueue.EnqueueString(one, "0123456789x"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull for too many bytes. Got: %v", err)
+	}
+	testPQueue.EnqueueString(one, "a")
+	if err = testPQueue.EnqueueString(one, "b"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull for too many messages. Got: %v", err)
+	}
+	if err = testPQueue.EnqueueValues(one, [][]byte{[]byte("c"), []byte("d"), []byte("e")}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull for a batch. Got: %v", err)
+	}
+
+	testPQueue.Dequeue()
+	if err = testPQueue.EnqueueString(one, "b"); err != nil {
+		t.Errorf("Expected room. Got: %v", err)
+	}
+	if n, _ := testPQueue.LenBytes(); n != 2 {
+		t.Errorf("Expected 2 bytes. Got: %d", n)
+	}
+}
+
+func TestDropWhenFull(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	testPQueue.MaxMessages = 3
+	testPQueue.Overflow = DropOldest
+
+	testPQueue.EnqueueString(five, "test message 5-1")
+	testPQueue.EnqueueString(one, "test message 1-1")
+	testPQueue.EnqueueString(one, "test message 1-2")
+	testPQueue.EnqueueString(five, "test message 5-2")
+
+	list, _ := testPQueue.PeekN(10)
+	expected := []string{"test message 5-1", "test message 5-2", "test message 1-2"}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d messages. Got: %d", len(expected), len(list))
+	}
+	for i, m := range list {
+		if m.String() != expected[i] {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected[i], m.String())
+		}
+	}
+
+	testPQueue.Overflow = DropNewest
+	m := NewMessage("dropped")
+	if err = testPQueue.Enqueue(five, m); err != nil {
+		t.Fatal(err)
+	}
+	if m.ID() != 0 || testPQueue.ApproxSize() != 3 {
+		t.Errorf("Expected the new message to be dropped. Got ID %d, size %d", m.ID(), testPQueue.ApproxSize())
+	}
+}
+
+func TestBlockWhenFull(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	testPQueue.MaxMessages = 1
+	testPQueue.Overflow = Block
+
+	testPQueue.EnqueueString(one, "a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err = testPQueue.EnqueueContext(ctx, one, NewMessage("b")); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded. Got: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- testPQueue.EnqueueString(one, "c")
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if s, _ := testPQueue.DequeueString(); s != "a" {
+		t.Errorf("Expected: \"a\", got: \"%s\"", s)
+	}
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue was not unblocked")
+	}
+
+	if s, _ := testPQueue.DequeueString(); s != "c" {
+		t.Errorf("Expected: \"c\", got: \"%s\"", s)
+	}
+}
+
+func TestIChanBlockWhenFull(t *testing.T) {
+	ich, err := NewIChan("./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ich.PQueue().MaxMessages = 1
+	ich.PQueue().Overflow = Block
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			if err := ich.SendString(fmt.Sprintf("test message %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+		ich.Close()
+	}()
+
+	i := 0
+	for v := range ich.ReceiveEnd() {
+		expected := fmt.Sprintf("test message %d", i)
+		if string(v) != expected {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected, string(v))
+		}
+		if n := ich.PQueue().ApproxSize(); n > 1 {
+			t.Errorf("Expected at most 1 message waiting. Got: %d", n)
+		}
+		time.Sleep(time.Millisecond)
+		i++
+	}
+	if i != 10 {
+		t.Errorf("Expected 10 messages. Got: %d", i)
+	}
+}
+
+func TestBlockWhenTooLarge(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	testPQueue.MaxMessages = 3
+	testPQueue.MaxBytes = 10
+	testPQueue.Overflow = Block
+
+	done := make(chan error)
+	go func() {
+		done <- testPQueue.EnqueueValues(one, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")})
+	}()
+	go func() {
+		done <- testPQueue.EnqueueString(one, "0123456789x")
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err = <-done:
+			if !errors.Is(err, ErrTooLarge) || !errors.Is(err, ErrQueueFull) {
+				t.Errorf("Expected ErrTooLarge. Got: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Enqueue was blocked")
+		}
+	}
+
+	if n, _ := testPQueue.Len(); n != 0 {
+		t.Errorf("Expected length 0. Got: %d", n)
+	}
+}
+
+func TestIChanSendEndBlockWhenFull(t *testing.T) {
+	ich, err := NewIChan("./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ich.PQueue().MaxMessages = 2
+	ich.PQueue().Overflow = Block
+	ich.SetErrorHandler(func(err error) {
+		t.Error(err)
+	})
+
+	// concurrent senders are gathered into batches larger than the queue
+	in := ich.SendEnd()
+	sent := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		go func(i int) {
+			in <- []byte(fmt.Sprintf("test message %d", i))
+			sent <- struct{}{}
+		}(i)
+	}
+	go func() {
+		for i := 0; i < 20; i++ {
+			<-sent
+		}
+		close(in)
+	}()
+
+	received := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for len(received) < 20 {
+		select {
+		case v := <-ich.ReceiveEnd():
+			received[string(v)] = true
+			if n := ich.PQueue().ApproxSize(); n > 2 {
+				t.Errorf("Expected at most 2 messages waiting. Got: %d", n)
+			}
+			time.Sleep(time.Millisecond)
+		case <-timeout:
+			t.Fatalf("Expected 20 messages. Got: %d", len(received))
+		}
+	}
+}
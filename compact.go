@@ -0,0 +1,138 @@
+package boltqueue
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// compactTxMaxSize limits the size of each transaction used when copying the database.
+const compactTxMaxSize = 64 << 20
+
+// Compact rewrites the queue's database file so that it no longer occupies space that was
+// freed when messages were removed; bbolt never shrinks its files otherwise. The contents
+// are copied to a new file, which then replaces the old one.
+//
+// The queue remains usable: other operations simply wait while the new file is swapped
+// in. However, the body of a loop over All or AtPriority must not use the queue while
+// Compact may be running, because the loop holds a transaction open.
+//
+// Only queues that opened their own file using NewPQueue etc can be compacted; named
+// queues, read-only queues and queues from WrapDB cannot.
+func (b *PQueue) Compact() error {
+	if !b.compactable() {
+		return fmt.Errorf("Cannot compact a queue whose database is not its own")
+	}
+
+	// the same order as Sync, to avoid deadlock
+	b.synced.mu.Lock()
+	defer b.synced.mu.Unlock()
+	b.connMu.Lock()
+	defer b.connMu.Unlock()
+
+	src := b.conn
+	path := src.Path()
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	// reopened as before, except that the durability may have changed since
+	opts := *b.boltOptions
+	opts.NoSync = src.NoSync
+
+	tmp := path + ".compact"
+	dst, err := bbolt.Open(tmp, info.Mode(), &bbolt.Options{NoSync: true})
+	if err != nil {
+		return err
+	}
+
+	err = bbolt.Compact(dst, src, compactTxMaxSize)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = src.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// if the new file cannot be swapped in, carry on with the old one
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+	}
+
+	db, openErr := bbolt.Open(path, info.Mode(), &opts)
+	if openErr != nil {
+		return openErr
+	}
+
+	b.conn = db
+	b.synced.written = 0
+	return err
+}
+
+func (b *PQueue) compactable() bool {
+	b.connMu.RLock()
+	defer b.connMu.RUnlock()
+	return b.owned && b.name == nil && !b.conn.IsReadOnly()
+}
+
+// StartAutoCompact starts a background goroutine that checks the queue's database at the
+// specified interval, compacting it when the proportion of its file that is free exceeds
+// the threshold, which is between 0 and 1. This does nothing for queues that cannot be
+// compacted.
+// The goroutine stops when the queue is closed.
+func (b *PQueue) StartAutoCompact(interval time.Duration, threshold float64) {
+	if !b.compactable() {
+		return
+	}
+
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.closing:
+				return
+			case <-ticker.C:
+				if free, err := b.freeSpace(); err == nil && free > threshold {
+					b.Compact()
+				}
+			}
+		}
+	}()
+}
+
+// freeSpace returns the proportion of the database file that is free.
+func (b *PQueue) freeSpace() (float64, error) {
+	var size int64
+	err := b.view(func(tx *bbolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	b.connMu.RLock()
+	stats := b.conn.Stats()
+	b.connMu.RUnlock()
+
+	return float64(stats.FreeAlloc) / float64(size), nil
+}
@@ -0,0 +1,121 @@
+package boltqueue
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func fileSize(t *testing.T, pq *PQueue) int64 {
+	t.Helper()
+	pq.connMu.RLock()
+	defer pq.connMu.RUnlock()
+	info, err := os.Stat(pq.conn.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func fillAndDrain(t *testing.T, pq *PQueue) {
+	t.Helper()
+	values := make([][]byte, 2000)
+	for i := range values {
+		values[i] = bytes.Repeat([]byte{'x'}, 1000)
+	}
+	if err := pq.EnqueueValues(one, values); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pq.Purge(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	fillAndDrain(t, testPQueue)
+	for p := one; p <= five; p++ {
+		testPQueue.EnqueueString(p, fmt.Sprintf("test message %d", p))
+	}
+	before := fileSize(t, testPQueue)
+
+	// producers carry on during compaction
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := testPQueue.EnqueueString(zero, "test message 0"); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	if err = testPQueue.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if after := fileSize(t, testPQueue); after >= before {
+		t.Errorf("Expected the file to shrink from %d. Got: %d", before, after)
+	}
+
+	if n, _ := testPQueue.Len(); n != 25 {
+		t.Errorf("Expected length 25. Got: %d", n)
+	}
+	for p := five; p >= one; p-- {
+		expected := fmt.Sprintf("test message %d", p)
+		if s, _ := testPQueue.DequeueString(); s != expected {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected, s)
+		}
+	}
+}
+
+func TestAutoCompact(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	fillAndDrain(t, testPQueue)
+	before := fileSize(t, testPQueue)
+	testPQueue.StartAutoCompact(10*time.Millisecond, 0.5)
+
+	for deadline := time.Now().Add(2 * time.Second); fileSize(t, testPQueue) >= before; {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the file to have been compacted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCompactShared(t *testing.T) {
+	db, err := bbolt.Open("testWrapped.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testWrapped.db")
+	defer db.Close()
+
+	testPQueue, err := WrapDB(db, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+	defer testPQueue.Close()
+
+	if err = testPQueue.Compact(); err == nil {
+		t.Error("Expected an error for a database that is not the queue's own")
+	}
+}
@@ -0,0 +1,183 @@
+package boltqueue
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// countsBucket is nested in the metadata bucket. It holds the number of messages waiting
+// at each non-empty priority, keyed by the name of the priority's bucket.
+var countsBucket = []byte("counts")
+
+// totalKey holds the number of messages waiting at all priorities, in the metadata bucket.
+var totalKey = []byte("total")
+
+// bytesKey holds the total size of the values of the messages waiting, in the metadata bucket.
+var bytesKey = []byte("bytes")
+
+// Len returns the number of messages waiting in the queue, not including scheduled or
+// in-flight messages or dead letters. This is exact and it does not depend on the
+// number of messages or priorities.
+func (b *PQueue) Len() (int64, error) {
+	var total int64
+	err := b.view(func(tx *bbolt.Tx) error {
+		if mb := b.bucket(tx, metaBucket); mb != nil {
+			total = int64(getUint64(mb.Get(totalKey)))
+		}
+		return nil
+	})
+	return total, err
+}
+
+// LenBytes returns the total size of the values of the messages waiting in the queue.
+func (b *PQueue) LenBytes() (int64, error) {
+	var size int64
+	err := b.view(func(tx *bbolt.Tx) error {
+		if mb := b.bucket(tx, metaBucket); mb != nil {
+			size = int64(getUint64(mb.Get(bytesKey)))
+		}
+		return nil
+	})
+	return size, err
+}
+
+// LenPriority returns the number of messages waiting in the queue at a given priority.
+func (b *PQueue) LenPriority(priority uint) (int, error) {
+	ipri := int64(priority)
+	if ipri > b.maxPriority {
+		return 0, fmt.Errorf("Invalid priority %d for LenPriority()", priority)
+	}
+
+	count := 0
+	err := b.view(func(tx *bbolt.Tx) error {
+		if cb := b.counts(tx); cb != nil {
+			count = int(getUint64(cb.Get(priBytes(ipri, b.maxPriority))))
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (b *PQueue) counts(tx *bbolt.Tx) *bbolt.Bucket {
+	if mb := b.bucket(tx, metaBucket); mb != nil {
+		return mb.Bucket(countsBucket)
+	}
+	return nil
+}
+
+// nonEmpty finds the highest priority, no higher than a limit, that has messages waiting.
+// The counts act as an index, so empty priorities cost nothing.
+func (b *PQueue) nonEmpty(tx *bbolt.Tx, limit int64) (int64, bool) {
+	cb := b.counts(tx)
+	if cb == nil || limit < 0 {
+		return 0, false
+	}
+
+	cur := cb.Cursor()
+	k, _ := cur.Seek(priBytes(limit, b.maxPriority))
+	if k == nil {
+		k, _ = cur.Last()
+	} else if priFromBytes(k) > limit {
+		k, _ = cur.Prev()
+	}
+
+	if k == nil {
+		return 0, false
+	}
+	return priFromBytes(k), true
+}
+
+// count adjusts the number of messages waiting at a priority, and the total size of their
+// values, within an Update transaction. Priorities that become empty are removed from
+// the counts.
+func (b *PQueue) count(tx *bbolt.Tx, priority, delta, size int64) error {
+	mb := b.bucket(tx, metaBucket)
+	if mb == nil {
+		return fmt.Errorf("Missing metadata; the queue may have been deleted")
+	}
+
+	cb, err := mb.CreateBucketIfNotExists(countsBucket)
+	if err != nil {
+		return err
+	}
+
+	err = adjust(cb, priBytes(priority, b.maxPriority), delta)
+	if err != nil {
+		return err
+	}
+	if err = adjust(mb, bytesKey, size); err != nil {
+		return err
+	}
+	return adjust(mb, totalKey, delta)
+}
+
+// adjust adds to a counter, deleting it when it reaches zero.
+func adjust(bucket *bbolt.Bucket, key []byte, delta int64) error {
+	n := int64(getUint64(bucket.Get(key))) + delta
+	if n <= 0 {
+		return bucket.Delete(key)
+	}
+	return bucket.Put(key, uint64Bytes(uint64(n)))
+}
+
+// recount sets the counters from the contents of the priority buckets, which is slow.
+func (b *PQueue) recount(tx *bbolt.Tx) error {
+	if err := b.resetCounts(tx); err != nil {
+		return err
+	}
+
+	for pri := b.maxPriority; pri >= 0; pri-- {
+		pb := b.bucket(tx, priBytes(pri, b.maxPriority))
+		if pb == nil {
+			continue
+		}
+
+		var n, size int64
+		err := pb.ForEach(func(k, v []byte) error {
+			m, err := decodeMessage(uint(pri), k, v)
+			if err != nil {
+				return err
+			}
+			n++
+			size += int64(len(m.value))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			if err = b.count(tx, pri, n, size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resetCounts sets all the counters to zero.
+func (b *PQueue) resetCounts(tx *bbolt.Tx) error {
+	mb := b.bucket(tx, metaBucket)
+	if mb == nil {
+		return nil
+	}
+
+	if mb.Bucket(countsBucket) != nil {
+		if err := mb.DeleteBucket(countsBucket); err != nil {
+			return err
+		}
+	}
+	if err := mb.Delete(bytesKey); err != nil {
+		return err
+	}
+	return mb.Delete(totalKey)
+}
+
+func getUint64(v []byte) uint64 {
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
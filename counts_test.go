@@ -0,0 +1,114 @@
+package boltqueue
+
+import (
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestLen(t *testing.T) {
+	testPQueue, err := NewPQueue("testCounts.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+
+	for p := one; p <= five; p++ {
+		testPQueue.EnqueueString(p, "a")
+		testPQueue.EnqueueString(p, "b")
+	}
+	testPQueue.Enqueue(one, NewMessage("stale").WithTTL(time.Nanosecond))
+	testPQueue.EnqueueAfter(one, time.Hour, NewMessage("later"))
+	testPQueue.DequeueLease(time.Hour)
+	testPQueue.Dequeue()
+
+	assertLen(t, testPQueue, 9, map[uint]int{zero: 0, one: 3, 4: 2, five: 0})
+	testPQueue.SweepExpired()
+	assertLen(t, testPQueue, 8, map[uint]int{one: 2})
+	testPQueue.Close()
+
+	// the counts persist
+	testPQueue, err = NewPQueue("testCounts.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+	assertLen(t, testPQueue, 8, map[uint]int{one: 2, 4: 2, five: 0})
+	if testPQueue.ApproxSize() != 8 {
+		t.Errorf("Expected approx size 8. Got: %d", testPQueue.ApproxSize())
+	}
+
+	// an older format queue is counted when it is opened
+	err = testPQueue.conn.Update(func(tx *bbolt.Tx) error {
+		mb := tx.Bucket(metaBucket)
+		if err := mb.DeleteBucket(countsBucket); err != nil {
+			return err
+		}
+		if err := mb.Delete(totalKey); err != nil {
+			return err
+		}
+		return mb.Put(versionKey, uint64Bytes(3))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.Close()
+
+	testPQueue, err = NewPQueue("testCounts.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	assertLen(t, testPQueue, 8, map[uint]int{one: 2, 4: 2, five: 0})
+}
+
+func assertLen(t *testing.T, pq *PQueue, total int64, priorities map[uint]int) {
+	t.Helper()
+	if n, err := pq.Len(); err != nil || n != total {
+		t.Errorf("Expected length %d. Got: %d, %v", total, n, err)
+	}
+	for p, expected := range priorities {
+		if n, err := pq.LenPriority(p); err != nil || n != expected {
+			t.Errorf("Expected length %d for priority %d. Got: %d, %v", expected, p, n, err)
+		}
+	}
+}
+
+func TestLenAfterRequeueTwice(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.Enqueue(five, NewMessage("a").WithTTL(time.Hour))
+	m, _ := testPQueue.Dequeue()
+	testPQueue.Requeue(five, m)
+	testPQueue.Requeue(five, m)
+	assertLen(t, testPQueue, 1, map[uint]int{five: 1})
+	if n, _ := testPQueue.LenBytes(); n != 1 {
+		t.Errorf("Expected 1 byte. Got: %d", n)
+	}
+
+	// a leased message that is requeued and then expires
+	m, _ = testPQueue.DequeueLease(20 * time.Millisecond)
+	testPQueue.Requeue(five, m)
+	time.Sleep(100 * time.Millisecond)
+	assertLen(t, testPQueue, 1, map[uint]int{five: 1})
+
+	testPQueue.Dequeue()
+	assertLen(t, testPQueue, 0, map[uint]int{five: 0})
+	if testPQueue.ApproxSize() != 0 {
+		t.Errorf("Expected approx size 0. Got: %d", testPQueue.ApproxSize())
+	}
+
+	// no phantom priorities are left to confuse DropOldest
+	testPQueue.MaxMessages = 1
+	testPQueue.Overflow = DropOldest
+	testPQueue.EnqueueString(one, "b")
+	testPQueue.EnqueueString(one, "c")
+	if s, _ := testPQueue.DequeueString(); s != "c" {
+		t.Errorf("Expected: \"c\", got: \"%s\"", s)
+	}
+}
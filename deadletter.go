@@ -0,0 +1,123 @@
+package boltqueue
+
+import (
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrNotDeadLetter is returned when a message is expected to be in the dead-letter store
+// but is not.
+var ErrNotDeadLetter = errors.New("Message is not in the dead-letter store.")
+
+// deadLetterBucket holds messages that exceeded MaxAttempts, keyed by message key.
+var deadLetterBucket = []byte("boltqueue.deadletter")
+
+// bury moves a message into the dead-letter store, within an Update transaction.
+func (b *PQueue) bury(tx *bbolt.Tx, m *Message) error {
+	db, err := b.createBucket(tx, deadLetterBucket)
+	if err != nil {
+		return err
+	}
+	return db.Put(m.key, encodeEntry(m))
+}
+
+// DeadLetters lists the messages in the dead-letter store, oldest first. Each message
+// reports the priority it had in the queue and the number of delivery attempts made.
+func (b *PQueue) DeadLetters() ([]*Message, error) {
+	var list []*Message
+
+	err := b.view(func(tx *bbolt.Tx) error {
+		db := b.bucket(tx, deadLetterBucket)
+		if db == nil {
+			return nil
+		}
+
+		return db.ForEach(func(k, v []byte) error {
+			m, err := decodeEntry(k, v)
+			if err == nil {
+				list = append(list, m)
+			}
+			return err
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// DeadLetterSize returns the number of messages in the dead-letter store.
+func (b *PQueue) DeadLetterSize() (int, error) {
+	count := 0
+	err := b.view(func(tx *bbolt.Tx) error {
+		if db := b.bucket(tx, deadLetterBucket); db != nil {
+			count = db.Stats().KeyN
+		}
+		return nil
+	})
+	return count, err
+}
+
+// ReplayDeadLetter moves a message from the dead-letter store back into the queue at
+// a specified priority (0=lowest), with its delivery attempts reset to zero.
+// It keeps its precedence as for Requeue.
+func (b *PQueue) ReplayDeadLetter(priority uint, m *Message) error {
+	if int64(priority) > b.maxPriority {
+		return fmt.Errorf("Invalid priority %d on ReplayDeadLetter", priority)
+	}
+
+	return b.update(func(tx *bbolt.Tx) error {
+		dead, err := b.unbury(tx, m)
+		if err != nil {
+			return err
+		}
+
+		dead.attempts = 0
+		return b.put(tx, int64(priority), dead.key, dead)
+	})
+}
+
+// DiscardDeadLetter permanently removes a message from the dead-letter store.
+func (b *PQueue) DiscardDeadLetter(m *Message) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		_, err := b.unbury(tx, m)
+		return err
+	})
+}
+
+// PurgeDeadLetters permanently removes all messages from the dead-letter store,
+// returning how many there were.
+func (b *PQueue) PurgeDeadLetters() (int, error) {
+	count := 0
+	err := b.update(func(tx *bbolt.Tx) error {
+		db := b.bucket(tx, deadLetterBucket)
+		if db == nil {
+			return nil
+		}
+		count = db.Stats().KeyN
+		return b.deleteBucket(tx, deadLetterBucket)
+	})
+	return count, err
+}
+
+// unbury removes a message from the dead-letter store and returns it as it was stored.
+func (b *PQueue) unbury(tx *bbolt.Tx, m *Message) (*Message, error) {
+	db := b.bucket(tx, deadLetterBucket)
+	if db == nil || m.key == nil {
+		return nil, ErrNotDeadLetter
+	}
+
+	v := db.Get(m.key)
+	if v == nil {
+		return nil, ErrNotDeadLetter
+	}
+
+	dead, err := decodeEntry(m.key, v)
+	if err != nil {
+		return nil, err
+	}
+	return dead, db.Delete(m.key)
+}
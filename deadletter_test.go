@@ -0,0 +1,142 @@
+package boltqueue
+
+import (
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestDeadLetters(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.MaxAttempts = 3
+	testPQueue.EnqueueString(five, "poison")
+	testPQueue.EnqueueString(one, "wholesome")
+
+	for n := 1; n <= 3; n++ {
+		m, err := testPQueue.DequeueLease(time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		} else if m.String() != "poison" || m.Attempts() != n {
+			t.Fatalf("Expected: \"poison\" attempt %d, got: \"%s\" attempt %d", n, m.String(), m.Attempts())
+		}
+
+		err = testPQueue.Nack(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dead, err := testPQueue.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(dead) != 1 {
+		t.Fatalf("Expected 1 dead letter. Got: %d", len(dead))
+	} else if dead[0].String() != "poison" || dead[0].Priority() != five || dead[0].Attempts() != 3 {
+		t.Errorf("Expected: \"poison\" at %d after 3 attempts, got: \"%s\" at %d after %d",
+			five, dead[0].String(), dead[0].Priority(), dead[0].Attempts())
+	}
+
+	m, err := testPQueue.DequeueString()
+	if err != nil {
+		t.Error(err)
+	} else if m != "wholesome" {
+		t.Errorf("Expected: \"wholesome\", got: \"%s\"", m)
+	}
+
+	err = testPQueue.ReplayDeadLetter(one, dead[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testPQueue.ReplayDeadLetter(one, dead[0])
+	if err != ErrNotDeadLetter {
+		t.Errorf("Expected ErrNotDeadLetter. Got: %v", err)
+	}
+
+	m2, err := testPQueue.Dequeue()
+	if err != nil {
+		t.Error(err)
+	} else if m2.String() != "poison" || m2.Priority() != one || m2.Attempts() != 1 {
+		t.Errorf("Expected: \"poison\" at %d attempt 1, got: \"%s\" at %d attempt %d", one, m2.String(), m2.Priority(), m2.Attempts())
+	}
+}
+
+func TestPurgeDeadLetters(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.MaxAttempts = 1
+	for n := 1; n <= 3; n++ {
+		testPQueue.EnqueueString(zero, "poison")
+	}
+
+	// the leases all expire without being acknowledged
+	for n := 1; n <= 3; n++ {
+		if _, err := testPQueue.DequeueLease(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := testPQueue.DequeueLease(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, _ := testPQueue.DeadLetterSize(); s != 3 {
+		t.Errorf("Expected 3 dead letters. Got: %d", s)
+	}
+
+	n, err := testPQueue.PurgeDeadLetters()
+	if err != nil {
+		t.Error(err)
+	} else if n != 3 {
+		t.Errorf("Expected 3 purged. Got: %d", n)
+	}
+
+	if s, _ := testPQueue.DeadLetterSize(); s != 0 {
+		t.Errorf("Expected 0 dead letters. Got: %d", s)
+	}
+}
+
+func TestLegacyFormatMigration(t *testing.T) {
+	db, err := bbolt.Open("testLegacy.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a version 0 queue holds bare values
+	err = db.Update(func(tx *bbolt.Tx) error {
+		pb, err := tx.CreateBucket(priBytes(3, 9))
+		if err != nil {
+			return err
+		}
+		pb.Put(uint64Bytes(1), []byte("first"))
+		return pb.Put(uint64Bytes(2), []byte("second"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testPQueue, err := WrapDB(db, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	for _, expected := range []string{"first", "second"} {
+		m, err := testPQueue.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		} else if m.String() != expected || m.Priority() != 3 {
+			t.Errorf("Expected: \"%s\" at 3, got: \"%s\" at %d", expected, m.String(), m.Priority())
+		}
+	}
+}
@@ -15,8 +15,59 @@ Messages are dequeued following priority order, then time
 ordering, with the oldest messages of the highest priority emerging
 first.
 
-There is no practical limit on the number of priorities, but a smaller number
-will typically give better performance than a larger number.
+Messages can also be scheduled using EnqueueAt or EnqueueAfter, in which case they
+remain invisible until they are due. Conversely, messages given a time-to-live using
+WithTTL are discarded once they expire, either by Dequeue or by a background sweeper.
+
+Enqueueing a message assigns it an ID. A waiting message can then be found using Get, and
+it can be cancelled, changed or escalated using Remove, UpdateValue or Reprioritize.
+Purge, PurgePriority and RemoveWhere remove many messages at once.
+
+The queue counts its messages as they are enqueued and dequeued, so Len and LenPriority
+are fast however many messages and priorities there are.
+MaxMessages and MaxBytes put a limit on the queue, in which case the Overflow policy
+determines whether new messages are rejected with ErrQueueFull, wait for room, or cause
+messages to be dropped.
+
+Each operation is a separate transaction, so throughput is limited by the speed of
+the disk. EnqueueBatch and DequeueN transfer many messages in one transaction instead.
+Where losing the most recent messages in a system crash is acceptable, SetDurability
+relaxes how often changes are synced to disk; Sync and Flush then sync them on demand.
+
+There is no practical limit on the number of priorities. Empty priorities are skipped
+without being visited, so a large number costs little.
+
+Dequeue returns nil when the queue is empty; DequeueWait instead blocks until a
+message is enqueued or its context is cancelled.
+
+Messages obtained using Dequeue are removed immediately. Alternatively, DequeueLease
+holds each message in-flight until it is acknowledged using Ack; if the consumer fails
+to do so before the lease times out, the message reappears in the queue.
+Every message counts its delivery attempts. When MaxAttempts is set, messages that
+repeatedly fail are moved to a dead-letter store, from which they can be listed,
+replayed into the queue or purged.
+
+Messages hold byte slices. TypedPQueue wraps a PQueue to hold values of any type
+instead, converting them using a Codec such as GobCodec or JSONCodec.
+
+NewPQueueWithOptions gives control over how the database file is opened, including
+its permissions, a lock timeout, bbolt's tuning options and a read-only mode.
+Database files never shrink by themselves; Compact rewrites the file to release the space
+left by removed messages, and StartAutoCompact does so whenever much of it is free.
+Backup and SnapshotTo take consistent copies of a queue while it is in use, and
+RestoreFrom creates a queue from such a copy.
+Export and Import instead transfer messages in a portable JSON Lines format, one message
+per line, which can be inspected using standard tools.
+
+Normally a PQueue occupies its database file entirely. Alternatively, OpenQueue
+provides named queues that each live in their own top-level bucket, so that many queues
+(and other application data) can share one file. Named queues persist when closed,
+until they are deleted by DeleteQueue.
+
+Each queue records its format version and number of priorities. Reopening a queue with a
+different number of priorities fails with ErrPriorityMismatch (pass zero to use the
+recorded number); MigratePriorities moves the messages of an existing queue to a new
+range of priorities.
 
 # File-backed Buffered Channel
 
@@ -31,6 +82,8 @@ using SendEnd() to obtain a normal channel. The latter is a nicer abstraction
 but requires one extra goroutine. If you care more about performance, use Send()
 and SendString() instead.
 
+TypedIChan wraps an IChan so that its ends carry values of any type, converted using a Codec.
+
 You cannot use both methods on the same IChan (it will panic if you do). This is
 to keep shutdown behaviour predictable.
 */
@@ -0,0 +1,113 @@
+package boltqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// Durability determines when changes to a queue are synced to disk, trading safety
+// against speed. Whatever the mode, a change that has been committed survives the process
+// crashing, because it has already been written to the operating system. The modes differ
+// in what can be lost if the operating system crashes or the power fails.
+type Durability int
+
+const (
+	// Synchronous syncs every transaction before it completes, so nothing that has been
+	// committed can be lost. This is the default, and the slowest.
+	Synchronous Durability = iota
+
+	// Periodic syncs in the background at a regular interval. Changes made during the
+	// last interval (plus the time taken by the sync) can be lost.
+	Periodic
+
+	// Unsynced only syncs when Sync or Flush is called, or the queue is closed. Any changes
+	// made since then can be lost.
+	//
+	// In both Periodic and Unsynced modes, losing the operating system part way through
+	// writing can also leave the file corrupted.
+	Unsynced
+)
+
+// defaultSyncInterval is used by Periodic durability when no interval is given.
+const defaultSyncInterval = time.Second
+
+// syncState tracks what has been synced to disk.
+type syncState struct {
+	mu      sync.Mutex
+	written int // the database's write count when it was last synced
+}
+
+// SetDurability chooses when changes are synced to disk. The interval applies to Periodic
+// durability; zero means one second. This should be called at most once, before the queue
+// is used. For named queues, this affects the whole database.
+func (b *PQueue) SetDurability(mode Durability, interval time.Duration) {
+	b.connMu.Lock()
+	b.conn.NoSync = mode != Synchronous
+	b.connMu.Unlock()
+
+	if mode != Periodic {
+		return
+	}
+
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.closing:
+				return
+			case <-ticker.C:
+				b.Flush()
+			}
+		}
+	}()
+}
+
+// Sync writes all committed changes to disk, whether or not there are any.
+func (b *PQueue) Sync() error {
+	b.synced.mu.Lock()
+	defer b.synced.mu.Unlock()
+	b.connMu.RLock()
+	defer b.connMu.RUnlock()
+
+	written := b.written()
+	if err := b.conn.Sync(); err != nil {
+		return err
+	}
+	b.synced.written = written
+	return nil
+}
+
+// Flush writes all committed changes to disk, but only if there have been any since the
+// last sync. This is cheap when there is nothing to do.
+func (b *PQueue) Flush() error {
+	if !b.unsynced() {
+		return nil
+	}
+	return b.Sync()
+}
+
+// unsynced tests whether there may be changes that have not been synced.
+func (b *PQueue) unsynced() bool {
+	b.synced.mu.Lock()
+	defer b.synced.mu.Unlock()
+	b.connMu.RLock()
+	defer b.connMu.RUnlock()
+
+	return b.conn.NoSync && b.written() != b.synced.written
+}
+
+// written counts the pages that have been written by the database's transactions.
+// The connection lock must be held.
+func (b *PQueue) written() int {
+	stats := b.conn.Stats()
+	return int(stats.TxStats.GetWrite())
+}
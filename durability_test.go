@@ -0,0 +1,75 @@
+package boltqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSynchronous(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.EnqueueString(one, "test message")
+	if testPQueue.unsynced() {
+		t.Error("Expected every change to have been synced")
+	}
+}
+
+func TestUnsynced(t *testing.T) {
+	testPQueue, err := NewPQueueWithOptions("testDurability.db", 10, &Options{Durability: Unsynced})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+
+	testPQueue.EnqueueString(one, "test message")
+	if !testPQueue.unsynced() {
+		t.Error("Expected an unsynced change")
+	}
+
+	if err = testPQueue.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if testPQueue.unsynced() {
+		t.Error("Expected the change to have been synced")
+	}
+
+	// closing syncs any remaining changes
+	testPQueue.EnqueueString(one, "another message")
+	if err = testPQueue.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	testPQueue, err = NewPQueue("testDurability.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	if n, _ := testPQueue.Len(); n != 2 {
+		t.Errorf("Expected length 2. Got: %d", n)
+	}
+}
+
+func TestPeriodic(t *testing.T) {
+	testPQueue, err := NewPQueueWithOptions("./", 10, &Options{
+		Durability:   Periodic,
+		SyncInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.EnqueueString(one, "test message")
+
+	for deadline := time.Now().Add(time.Second); testPQueue.unsynced(); {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the change to have been synced within the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,172 @@
+package boltqueue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Each stored message is wrapped in an envelope that holds its persistent attributes
+// as well as its value. The first byte is the envelope version; the second is a set of
+// flags indicating which optional fields follow, in this order:
+//
+//	hasAttempts   - uvarint delivery attempts
+//	hasExpiry     - 8-byte expiry time (Unix nanoseconds)
+//	hasEnqueuedAt - 8-byte enqueue time (Unix nanoseconds)
+//	hasHeaders    - uvarint count, then each name and value as a uvarint length and bytes
+//
+// The value makes up the remainder. Envelopes written before a field was introduced
+// simply lack its flag, so they remain readable. Unknown flags are rejected because
+// they were written by a newer version.
+const envelopeVersion = 1
+
+const (
+	hasAttempts = 1 << iota
+	hasExpiry
+	hasEnqueuedAt
+	hasHeaders
+
+	knownFlags = hasAttempts | hasExpiry | hasEnqueuedAt | hasHeaders
+)
+
+// encode wraps the message value in an envelope.
+func (m *Message) encode() []byte {
+	e := make([]byte, 2, 2+binary.MaxVarintLen64+16+len(m.value))
+	e[0] = envelopeVersion
+
+	if m.attempts > 0 {
+		e[1] |= hasAttempts
+		e = binary.AppendUvarint(e, uint64(m.attempts))
+	}
+
+	if !m.expires.IsZero() {
+		e[1] |= hasExpiry
+		e = binary.BigEndian.AppendUint64(e, uint64(m.expires.UnixNano()))
+	}
+
+	if !m.enqueued.IsZero() {
+		e[1] |= hasEnqueuedAt
+		e = binary.BigEndian.AppendUint64(e, uint64(m.enqueued.UnixNano()))
+	}
+
+	if len(m.headers) > 0 {
+		e[1] |= hasHeaders
+		names := make([]string, 0, len(m.headers))
+		for name := range m.headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		e = binary.AppendUvarint(e, uint64(len(names)))
+		for _, name := range names {
+			e = appendString(e, name)
+			e = appendString(e, m.headers[name])
+		}
+	}
+
+	return append(e, m.value...)
+}
+
+func appendString(e []byte, s string) []byte {
+	e = binary.AppendUvarint(e, uint64(len(s)))
+	return append(e, s...)
+}
+
+// decodeMessage unwraps a stored envelope. The key and data are copied so the message
+// remains valid after the transaction ends.
+func decodeMessage(priority uint, key, data []byte) (*Message, error) {
+	if len(data) < 2 || data[0] != envelopeVersion || data[1]&^knownFlags != 0 {
+		return nil, fmt.Errorf("Unsupported message envelope for key %x", key)
+	}
+
+	m := &Message{priority: priority, key: cloneBytes(key)}
+	flags := data[1]
+	r := &envelopeReader{rest: data[2:], ok: true}
+
+	if flags&hasAttempts != 0 {
+		m.attempts = int(r.uvarint())
+	}
+
+	if flags&hasExpiry != 0 {
+		m.expires = r.time()
+	}
+
+	if flags&hasEnqueuedAt != 0 {
+		m.enqueued = r.time()
+	}
+
+	if flags&hasHeaders != 0 {
+		n := r.uvarint()
+		m.headers = make(map[string]string, min(n, 64))
+		for i := uint64(0); i < n && r.ok; i++ {
+			name := r.string()
+			m.headers[name] = r.string()
+		}
+	}
+
+	if !r.ok {
+		return nil, fmt.Errorf("Corrupt message envelope for key %x", key)
+	}
+
+	m.value = cloneBytes(r.rest)
+	return m, nil
+}
+
+// envelopeReader consumes the fields of an envelope. After any field is found to be
+// truncated, ok is false and all further fields are zero.
+type envelopeReader struct {
+	rest []byte
+	ok   bool
+}
+
+func (r *envelopeReader) uvarint() uint64 {
+	n, w := binary.Uvarint(r.rest)
+	if w <= 0 {
+		r.fail()
+		return 0
+	}
+	r.rest = r.rest[w:]
+	return n
+}
+
+func (r *envelopeReader) time() time.Time {
+	if len(r.rest) < 8 {
+		r.fail()
+		return time.Time{}
+	}
+	t := time.Unix(0, int64(binary.BigEndian.Uint64(r.rest)))
+	r.rest = r.rest[8:]
+	return t
+}
+
+func (r *envelopeReader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.rest)) {
+		r.fail()
+		return ""
+	}
+	s := string(r.rest[:n])
+	r.rest = r.rest[n:]
+	return s
+}
+
+func (r *envelopeReader) fail() {
+	r.ok = false
+	r.rest = nil
+}
+
+// encodeEntry prefixes an envelope with its priority, for buckets that hold messages
+// of mixed priorities.
+func encodeEntry(m *Message) []byte {
+	e := make([]byte, 8)
+	binary.BigEndian.PutUint64(e, uint64(m.priority))
+	return append(e, m.encode()...)
+}
+
+func decodeEntry(key, e []byte) (*Message, error) {
+	if len(e) < 8 {
+		return nil, fmt.Errorf("Corrupt entry for key %x", key)
+	}
+	return decodeMessage(uint(binary.BigEndian.Uint64(e)), key, e[8:])
+}
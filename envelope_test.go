@@ -0,0 +1,69 @@
+package boltqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeaders(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	before := time.Now()
+	err = testPQueue.Enqueue(five, NewMessage("traced").
+		WithHeader("trace-id", "abc123").
+		WithHeader("content-type", "text/plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := testPQueue.DequeueLease(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.Nack(m)
+
+	m, err = testPQueue.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Header("trace-id") != "abc123" || m.Header("content-type") != "text/plain" || m.Header("tenant") != "" {
+		t.Errorf("Unexpected headers: %v", m.Headers())
+	}
+	if len(m.Headers()) != 2 {
+		t.Errorf("Expected 2 headers. Got: %v", m.Headers())
+	}
+	if m.EnqueuedAt().Before(before) || m.EnqueuedAt().After(time.Now()) {
+		t.Errorf("Unexpected enqueue time: %v", m.EnqueuedAt())
+	}
+	if m.Attempts() != 2 {
+		t.Errorf("Expected 2 attempts. Got: %d", m.Attempts())
+	}
+}
+
+func TestEnvelopeCompatibility(t *testing.T) {
+	// written before headers and enqueue times were recorded
+	m, err := decodeMessage(3, []byte("k"), []byte{envelopeVersion, hasAttempts, 2, 'o', 'l', 'd'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.String() != "old" || m.Attempts() != 2 || !m.EnqueuedAt().IsZero() || len(m.Headers()) != 0 {
+		t.Errorf("Unexpected message: %q %d %v %v", m.String(), m.Attempts(), m.EnqueuedAt(), m.Headers())
+	}
+
+	// written by some future version
+	_, err = decodeMessage(3, []byte("k"), []byte{envelopeVersion, 0x80, 'n', 'e', 'w'})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+
+	// truncated
+	_, err = decodeMessage(3, []byte("k"), []byte{envelopeVersion, hasHeaders, 1, 5, 'a'})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
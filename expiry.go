@@ -0,0 +1,120 @@
+package boltqueue
+
+import (
+	"encoding/binary"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// expiryBucket indexes the queued messages that have a time-to-live. Its keys are the
+// expiry time followed by the message key; its values are the message priorities.
+var expiryBucket = []byte("boltqueue.expiry")
+
+// SetExpiryHandler registers a function that is told about each message that expired
+// and was discarded, whether by Dequeue or by the sweeper. It is called after the
+// message has been removed.
+func (b *PQueue) SetExpiryHandler(fn func(*Message)) {
+	b.expiryHandler = fn
+}
+
+// SweepExpired removes all expired messages from the queue, returning how many there were.
+func (b *PQueue) SweepExpired() (int, error) {
+	count := 0
+	err := b.update(func(tx *bbolt.Tx) error {
+		var err error
+		count, err = b.sweep(tx, time.Now())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// StartSweeper starts a background goroutine that removes expired messages at the specified
+// interval. This is not needed for correctness, because Dequeue never returns expired
+// messages, but it avoids them accumulating when the queue is not being consumed.
+// The sweeper stops when the queue is closed.
+func (b *PQueue) StartSweeper(interval time.Duration) {
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.closing:
+				return
+			case <-ticker.C:
+				b.SweepExpired()
+			}
+		}
+	}()
+}
+
+// expire reports a message that has been discarded because it expired.
+func (b *PQueue) expire(tx *bbolt.Tx, m *Message) {
+	if b.expiryHandler != nil {
+		tx.OnCommit(func() {
+			b.expiryHandler(m)
+		})
+	}
+}
+
+// sweep removes all messages that had expired by a given time.
+func (b *PQueue) sweep(tx *bbolt.Tx, now time.Time) (int, error) {
+	eb := b.bucket(tx, expiryBucket)
+	if eb == nil {
+		return 0, nil
+	}
+
+	count := 0
+	limit := uint64(now.UnixNano())
+	cur := eb.Cursor()
+	for k, v := cur.First(); k != nil && binary.BigEndian.Uint64(k) <= limit; k, v = cur.First() {
+		// the message key follows the expiry time
+		key := cloneBytes(k[8:])
+		pri := int64(binary.BigEndian.Uint64(v))
+
+		if pb := b.bucket(tx, priBytes(pri, b.maxPriority)); pb != nil {
+			if data := pb.Get(key); data != nil {
+				m, err := decodeMessage(uint(pri), key, data)
+				if err != nil {
+					return count, err
+				}
+				if err := pb.Delete(key); err != nil {
+					return count, err
+				}
+				if err := b.count(tx, pri, -1, -int64(len(m.value))); err != nil {
+					return count, err
+				}
+				tx.OnCommit(b.removed)
+				b.expire(tx, m)
+				count++
+			}
+		}
+
+		if err := cur.Delete(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func (b *PQueue) indexExpiry(tx *bbolt.Tx, priority int64, key []byte, expires time.Time) error {
+	eb, err := b.createBucket(tx, expiryBucket)
+	if err != nil {
+		return err
+	}
+	return eb.Put(timedKey(expires, key), uint64Bytes(uint64(priority)))
+}
+
+func (b *PQueue) unindexExpiry(tx *bbolt.Tx, key []byte, expires time.Time) error {
+	if eb := b.bucket(tx, expiryBucket); eb != nil {
+		return eb.Delete(timedKey(expires, key))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package boltqueue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDequeueDiscardsExpired(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	var expired []string
+	testPQueue.SetExpiryHandler(func(m *Message) {
+		expired = append(expired, m.String())
+	})
+
+	testPQueue.Enqueue(five, NewMessage("stale").WithTTL(time.Millisecond))
+	testPQueue.Enqueue(five, NewMessage("fresh").WithTTL(time.Hour))
+	testPQueue.EnqueueString(one, "timeless")
+
+	time.Sleep(5 * time.Millisecond)
+
+	for _, expected := range []string{"fresh", "timeless", ""} {
+		m, err := testPQueue.DequeueString()
+		if err != nil {
+			t.Error(err)
+		} else if m != expected {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected, m)
+		}
+	}
+
+	if len(expired) != 1 || expired[0] != "stale" {
+		t.Errorf("Expected [stale] to expire. Got: %v", expired)
+	}
+}
+
+func TestSweeper(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	var mu sync.Mutex
+	expired := 0
+	testPQueue.SetExpiryHandler(func(m *Message) {
+		mu.Lock()
+		expired++
+		mu.Unlock()
+	})
+
+	for p := one; p <= five; p++ {
+		testPQueue.Enqueue(p, NewMessagef("test message %d", p).WithTTL(10*time.Millisecond))
+		testPQueue.Enqueue(p, NewMessagef("test message %d", p).WithTTL(time.Hour))
+	}
+
+	testPQueue.StartSweeper(5 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	if testPQueue.ApproxSize() != 5 {
+		t.Errorf("Expected total size 5. Got: %d", testPQueue.ApproxSize())
+	}
+	if s, _ := testPQueue.TotalSize(); s != 5 {
+		t.Errorf("Expected total size 5. Got: %d", s)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expired != 5 {
+		t.Errorf("Expected 5 expired. Got: %d", expired)
+	}
+}
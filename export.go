@@ -0,0 +1,226 @@
+package boltqueue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// importBatchSize limits how many messages Import stores in each transaction.
+const importBatchSize = 1000
+
+// record is one line of the export format. Each line is a JSON object with these fields:
+//
+//	id        the message's ID in the exporting queue (informational only)
+//	priority  the message's priority
+//	value     the message's value, base64 encoded
+//	headers   an object holding the message's headers, if it has any
+//	enqueued  when the message was first enqueued, in RFC 3339 format, if known
+//	expires   when the message expires, in RFC 3339 format, if it has a time-to-live
+//	due       when a scheduled message is due, in RFC 3339 format
+//	attempts  how many times the message has been delivered, if any
+type record struct {
+	ID       uint64            `json:"id"`
+	Priority uint              `json:"priority"`
+	Value    []byte            `json:"value"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Enqueued time.Time         `json:"enqueued,omitzero"`
+	Expires  time.Time         `json:"expires,omitzero"`
+	Due      time.Time         `json:"due,omitzero"`
+	Attempts int               `json:"attempts,omitempty"`
+}
+
+// Export writes the queued messages to w in JSON Lines format, one message per line,
+// returning how many were written. Messages that are waiting are written in dequeue
+// order, followed by scheduled messages in the order they are due. In-flight messages,
+// dead letters and expired messages are not included. The output is a consistent
+// snapshot of the queue.
+func (b *PQueue) Export(w io.Writer) (int, error) {
+	return b.ExportRange(w, 0, uint(b.maxPriority))
+}
+
+// ExportRange writes the queued messages with priorities from lowest to highest
+// inclusive, as for Export.
+func (b *PQueue) ExportRange(w io.Writer, lowest, highest uint) (int, error) {
+	if int64(highest) > b.maxPriority || lowest > highest {
+		return 0, fmt.Errorf("Invalid priority range %d to %d for Export", lowest, highest)
+	}
+
+	count := 0
+	enc := json.NewEncoder(w)
+	write := func(m *Message, due time.Time) error {
+		count++
+		return enc.Encode(&record{
+			ID:       m.ID(),
+			Priority: m.priority,
+			Value:    m.value,
+			Headers:  m.headers,
+			Enqueued: m.enqueued,
+			Expires:  m.expires,
+			Due:      due,
+			Attempts: m.attempts,
+		})
+	}
+
+	err := b.view(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		for pri, ok := b.nonEmpty(tx, int64(highest)); ok && pri >= int64(lowest); pri, ok = b.nonEmpty(tx, pri-1) {
+			err := b.scanPriority(tx, pri, func(m *Message) (bool, error) {
+				if m.Expired(now) {
+					return true, nil
+				}
+				return true, write(m, time.Time{})
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		sb := b.bucket(tx, scheduledBucket)
+		if sb == nil {
+			return nil
+		}
+
+		// the message key follows the due time
+		return sb.ForEach(func(k, v []byte) error {
+			m, err := decodeEntry(k[8:], v)
+			if err != nil || m.priority < lowest || m.priority > highest {
+				return err
+			}
+			return write(m, time.Unix(0, int64(binary.BigEndian.Uint64(k))))
+		})
+	})
+
+	return count, err
+}
+
+// Import reads messages from r in the JSON Lines format written by Export and adds them
+// to the queue, returning how many were added. Each message keeps its priority, headers,
+// timestamps and delivery attempts, and messages of the same priority keep their order.
+// They are given new IDs. Scheduled messages remain scheduled until they are due.
+//
+// Messages are stored in batches, as for EnqueueBatch, including the handling of a full
+// queue. A message whose priority is too high for this queue is an error. If an error
+// occurs, the earlier batches have already been stored, but not the one containing the
+// faulty record.
+func (b *PQueue) Import(r io.Reader) (int, error) {
+	return b.importRange(r, 0, uint(b.maxPriority), false)
+}
+
+// ImportRange reads messages as for Import, but only adds those with priorities from
+// lowest to highest inclusive; the others are skipped.
+func (b *PQueue) ImportRange(r io.Reader, lowest, highest uint) (int, error) {
+	if int64(highest) > b.maxPriority || lowest > highest {
+		return 0, fmt.Errorf("Invalid priority range %d to %d for Import", lowest, highest)
+	}
+	return b.importRange(r, lowest, highest, true)
+}
+
+// importRange reads messages with priorities from lowest to highest inclusive. The others
+// are skipped if filtering, otherwise they are an error.
+func (b *PQueue) importRange(r io.Reader, lowest, highest uint, filter bool) (int, error) {
+	count := 0
+	dec := json.NewDecoder(r)
+	var batch []*record
+
+	for line := 1; ; line++ {
+		rec := &record{}
+		err := dec.Decode(rec)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return count, fmt.Errorf("Invalid record %d on Import: %w", line, err)
+		}
+
+		if rec.Priority < lowest || rec.Priority > highest {
+			if filter {
+				continue
+			}
+			return count, fmt.Errorf("Invalid priority %d on record %d for Import", rec.Priority, line)
+		}
+
+		batch = append(batch, rec)
+		if len(batch) == importBatchSize {
+			if err = b.importBatch(batch); err != nil {
+				return count, err
+			}
+			count += len(batch)
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := b.importBatch(batch); err != nil {
+			return count, err
+		}
+		count += len(batch)
+	}
+	return count, nil
+}
+
+// importBatch stores imported messages in one transaction.
+func (b *PQueue) importBatch(batch []*record) error {
+	now := time.Now()
+	messages := make([]*Message, len(batch))
+	var n, size int64
+
+	for i, rec := range batch {
+		m := &Message{
+			value:    rec.Value,
+			priority: rec.Priority,
+			attempts: rec.Attempts,
+			enqueued: rec.Enqueued,
+			expires:  rec.Expires,
+			headers:  rec.Headers,
+		}
+		m.stamp(now)
+		messages[i] = m
+
+		if !rec.Due.After(now) {
+			n++
+			size += int64(len(m.value))
+		}
+	}
+
+	scheduled := false
+	err := b.whenRoom(context.Background(), func() error {
+		return b.write(func(tx *bbolt.Tx) error {
+			scheduled = false
+			ok, err := b.makeRoom(tx, n, size)
+			if !ok || err != nil {
+				return err
+			}
+
+			for i, m := range messages {
+				if m.key, err = b.nextKey(tx); err != nil {
+					return err
+				}
+
+				if due := batch[i].Due; due.After(now) {
+					sb, err := b.createBucket(tx, scheduledBucket)
+					if err != nil {
+						return err
+					}
+					if err = sb.Put(timedKey(due, m.key), encodeEntry(m)); err != nil {
+						return err
+					}
+					scheduled = true
+				} else if err = b.put(tx, int64(m.priority), m.key, m); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+
+	if err == nil && scheduled {
+		b.reschedule()
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package boltqueue
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	populate(t, testPQueue)
+	testPQueue.Enqueue(one, NewMessage("stale").WithTTL(time.Nanosecond))
+
+	buf := &bytes.Buffer{}
+	n, err := testPQueue.Export(buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 19 {
+		t.Errorf("Expected 19 messages. Got: %d", n)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	first := map[string]any{}
+	if err = json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	// "test message 5-1" in base64
+	if first["priority"] != 5.0 || first["value"] != "dGVzdCBtZXNzYWdlIDUtMQ==" || first["enqueued"] == nil {
+		t.Errorf("Unexpected first line: %s", lines[0])
+	}
+	if !strings.Contains(lines[18], `"due":`) {
+		t.Errorf("Expected the scheduled message last. Got: %s", lines[18])
+	}
+
+	other, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	n, err = other.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 19 {
+		t.Errorf("Expected 19 messages. Got: %d", n)
+	}
+	if s, _ := other.ScheduledSize(); s != 1 {
+		t.Errorf("Expected 1 scheduled message. Got: %d", s)
+	}
+
+	m, _ := other.Peek()
+	if m.Header("n") != "1" || m.EnqueuedAt().IsZero() {
+		t.Errorf("Expected headers and timestamps to be kept. Got: %v, %v", m.Headers(), m.EnqueuedAt())
+	}
+
+	// IDs are not kept, so only the rest is compared
+	strip := func(list []string) []string {
+		for i, s := range list {
+			list[i] = s[strings.Index(s, " ")+1:]
+		}
+		return list
+	}
+	assertSameOrder(t, strip(drain(t, testPQueue)), strip(drain(t, other)))
+}
+
+func TestExportImportRange(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	populate(t, testPQueue)
+
+	buf := &bytes.Buffer{}
+	n, err := testPQueue.ExportRange(buf, one, 3)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 10 {
+		t.Errorf("Expected 10 messages. Got: %d", n)
+	}
+
+	testPQueue.Purge()
+	n, err = testPQueue.ImportRange(buf, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 6 {
+		t.Errorf("Expected 6 messages. Got: %d", n)
+	}
+	assertLen(t, testPQueue, 6, map[uint]int{one: 0, 2: 3, 3: 3})
+
+	if _, err = testPQueue.ExportRange(buf, 3, one); err == nil {
+		t.Error("Expected an error for an invalid range")
+	}
+	if _, err = testPQueue.Import(strings.NewReader("{not json")); err == nil {
+		t.Error("Expected an error for invalid input")
+	}
+}
+
+func TestImportInvalidPriority(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+	testPQueue.EnqueueString(9, "test message 9")
+	testPQueue.EnqueueString(one, "test message 1")
+
+	buf := &bytes.Buffer{}
+	if _, err = testPQueue.Export(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewPQueue("./", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	n, err := other.Import(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		t.Error("Expected an error for a priority that is too high")
+	} else if n != 0 {
+		t.Errorf("Expected 0 messages. Got: %d", n)
+	}
+	if size, _ := other.Len(); size != 0 {
+		t.Errorf("Expected length 0. Got: %d", size)
+	}
+
+	// an explicit range skips the others
+	n, err = other.ImportRange(bytes.NewReader(buf.Bytes()), 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Errorf("Expected 1 message. Got: %d", n)
+	}
+}
@@ -0,0 +1,80 @@
+package boltqueue
+
+import (
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// coalescer implements group commit. The first caller becomes the leader and commits its
+// own work immediately. Meanwhile, other callers queue up; when the leader has finished,
+// it hands over to the first of them, who then commits everything that has queued up in
+// one transaction. Unlike bbolt's DB.Batch, no caller ever waits for a timer.
+type coalescer struct {
+	mu      sync.Mutex
+	pending []*groupCall
+	running bool
+}
+
+type groupCall struct {
+	fn   func(*bbolt.Tx) error
+	err  error
+	done chan bool // receives true to become the leader, or false when committed
+}
+
+// update runs fn in a transaction shared with any concurrent callers. It returns only after
+// the transaction has been committed. Note that fn may be called more than once so it
+// must be idempotent.
+func (c *coalescer) update(db *bbolt.DB, fn func(*bbolt.Tx) error) error {
+	call := &groupCall{fn: fn, done: make(chan bool, 1)}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, call)
+	lead := !c.running
+	c.running = true
+	c.mu.Unlock()
+
+	if !lead && !<-call.done {
+		return call.err
+	}
+
+	c.mu.Lock()
+	group := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	commitGroup(db, group)
+
+	c.mu.Lock()
+	if len(c.pending) > 0 {
+		next := c.pending[0]
+		c.mu.Unlock()
+		next.done <- true
+	} else {
+		c.running = false
+		c.mu.Unlock()
+	}
+
+	return call.err
+}
+
+func commitGroup(db *bbolt.DB, group []*groupCall) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		for _, call := range group {
+			if err := call.fn(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	for _, call := range group {
+		if err != nil && len(group) > 1 {
+			// one of them failed, so they each need their own transaction to find out which
+			call.err = db.Update(call.fn)
+		} else {
+			call.err = err
+		}
+		call.done <- false
+	}
+}
@@ -1,7 +1,12 @@
 package boltqueue
 
+import "errors"
+
 type ErrorHandler func(error)
 
+// maxSendBatch limits how many values SendEnd stores in one transaction.
+const maxSendBatch = 1000
+
 type puller struct {
 	pqueue    *PQueue
 	eh        func(error)
@@ -38,7 +43,7 @@ func NewIChanOf(pq *PQueue) *IChan {
 	puller := &puller{
 		pqueue:    ichan.pqueue,
 		poke:      ichan.poke,
-		queueSize: ichan.pqueue.size,
+		queueSize: ichan.pqueue.size.Load(),
 	}
 	ichan.puller = puller
 
@@ -48,6 +53,12 @@ func NewIChanOf(pq *PQueue) *IChan {
 	return ichan
 }
 
+// PQueue gets the queue that holds the channel's buffered messages, for example to limit
+// its size using MaxMessages and Overflow, which then apply to Send and SendEnd.
+func (c *IChan) PQueue() *PQueue {
+	return c.pqueue
+}
+
 // SetErrorHandler registers a function to handle errors at the receiving end.
 func (c *IChan) SetErrorHandler(eh func(error)) {
 	c.eh = eh
@@ -61,6 +72,10 @@ func (c *IChan) SetErrorHandler(eh func(error)) {
 // selection is made between them and only one goroutine receives each message (this is normal
 // Go behaviour).
 //
+// Values sent concurrently by several goroutines are stored in batches, which is much
+// faster than storing them one at a time. If the queue has limits, a batch that does not
+// fit is stored one value at a time instead, so the overflow policy applies to each value.
+//
 // When you have finished, you muse close the channel (as is normal for Go channels), otherwise
 // the resources will not be released cleanly.
 //
@@ -71,10 +86,7 @@ func (c *IChan) SendEnd() chan<- []byte {
 		c.input = make(chan []byte)
 		go func() {
 			for v := range c.input {
-				err := c.send(v)
-				if err != nil && c.eh != nil {
-					c.eh(err)
-				}
+				c.sendBatch(c.gather(v))
 			}
 			c.doClose()
 		}()
@@ -82,6 +94,24 @@ func (c *IChan) SendEnd() chan<- []byte {
 	return c.input
 }
 
+// gather collects any further values that senders are already waiting to send, so that
+// they can all be stored in one transaction.
+func (c *IChan) gather(v []byte) [][]byte {
+	batch := [][]byte{v}
+	for len(batch) < maxSendBatch {
+		select {
+		case v, ok := <-c.input:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, v)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
 // SendString sends a message via the channel.
 // This is a direct function call unlike interacting with a channel end. Once SendEnd()
 // has been used, you cannot then use this method too.
@@ -103,6 +133,30 @@ func (c *IChan) send(value []byte) error {
 	return err
 }
 
+// sendBatch stores values in one transaction if they fit in the queue, otherwise one at a
+// time. Errors are reported to the error handler.
+func (c *IChan) sendBatch(values [][]byte) {
+	// DropNewest would silently discard the whole batch
+	if len(values) > 1 && c.pqueue.Overflow != DropNewest {
+		err := c.pqueue.EnqueueValues(0, values)
+		if !errors.Is(err, ErrQueueFull) {
+			c.poke <- struct{}{}
+			c.report(err)
+			return
+		}
+	}
+
+	for _, v := range values {
+		c.report(c.send(v))
+	}
+}
+
+func (c *IChan) report(err error) {
+	if err != nil && c.eh != nil {
+		c.eh(err)
+	}
+}
+
 // Close closes the channel and its underlying queue.
 // This is a direct function call unlike interacting with a channel end. Once SendEnd()
 // has been used, you cannot then use this method too. You need instead to close the channel
@@ -135,7 +189,7 @@ func (p *puller) sendOn(value []byte, ch chan<- []byte) bool {
 			p.queueSize++
 
 		} else {
-			return false // terminate
+			p.poke = nil // closed; carry on until the queue has been drained
 		}
 
 	case ch <- value:
@@ -145,6 +199,9 @@ func (p *puller) sendOn(value []byte, ch chan<- []byte) bool {
 }
 
 func (p *puller) deq(ch chan<- []byte) bool {
+	// obtained beforehand so that no scheduled messages are missed
+	ready := p.pqueue.ready.wait()
+
 	//fmt.Printf("DequeueValue...\n")
 	value, err := p.pqueue.DequeueValue()
 	if err != nil {
@@ -160,13 +217,22 @@ func (p *puller) deq(ch chan<- []byte) bool {
 		return p.sendOn(value, ch)
 	}
 
-	_, ok := <-p.poke
-	if ok {
-		p.queueSize++
+	if p.poke == nil {
+		return false // closed and drained; terminate
+	}
+
+	select {
+	case _, ok := <-p.poke:
+		if ok {
+			p.queueSize++
+
+		} else {
+			p.poke = nil // closed; carry on until the queue has been drained
+		}
 		return true // keep going
 
-	} else {
-		return false // terminate
+	case <-ready:
+		return true // scheduled messages have become due
 	}
 }
 
@@ -87,3 +87,127 @@ func TestIChanUsingChannel(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestIChanUsingChannelConcurrently(t *testing.T) {
+	ich, err := NewIChan("./")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ich.SetErrorHandler(func(e error) {
+		panic(e)
+	})
+
+	received := make(map[string]bool)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		for v := range ich.ReceiveEnd() {
+			received[string(v)] = true
+		}
+		wg.Done()
+	}()
+
+	in := ich.SendEnd()
+
+	var senders sync.WaitGroup
+	for g := 1; g <= 10; g++ {
+		senders.Add(1)
+		go func() {
+			for p := 1; p <= 100; p++ {
+				in <- []byte(fmt.Sprintf("%d-%d", g, p))
+			}
+			senders.Done()
+		}()
+	}
+	senders.Wait()
+	close(in)
+
+	wg.Wait()
+
+	if len(received) != 1000 {
+		t.Errorf("Expected 1000 messages. Got: %d", len(received))
+	}
+}
+
+func TestTypedIChan(t *testing.T) {
+	ich, err := NewTypedIChan[int]("./", JSONCodec[int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	ich.SetErrorHandler(func(e error) {
+		mu.Lock()
+		errs = append(errs, e)
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		i := 1
+		for v := range ich.ReceiveEnd() {
+			if v != i {
+				t.Errorf("Expected: %d, got: %d", i, v)
+			}
+			i++
+		}
+		if i != 101 {
+			t.Errorf("Expected 100 values. Got: %d", i-1)
+		}
+		wg.Done()
+	}()
+
+	for p := 1; p <= 100; p++ {
+		err = ich.Send(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == 50 {
+			// bypasses the codec
+			ich.ichan.SendString("not json")
+		}
+	}
+	ich.Close()
+
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error. Got: %v", errs)
+	}
+	if de, ok := errs[0].(*DecodeError); !ok || de.Message.String() != "not json" {
+		t.Errorf("Expected a DecodeError. Got: %v", errs[0])
+	}
+}
+
+func TestTypedIChanUsingChannel(t *testing.T) {
+	ich, err := NewTypedIChan[string]("./", StringCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		i := 1
+		for v := range ich.ReceiveEnd() {
+			expected := fmt.Sprintf("%d", i)
+			if v != expected {
+				t.Errorf("Expected: \"%s\", got: \"%s\"", expected, v)
+			}
+			i++
+		}
+		wg.Done()
+	}()
+
+	for p := 1; p <= 100; p++ {
+		ich.SendEnd() <- fmt.Sprintf("%d", p)
+	}
+	close(ich.SendEnd())
+
+	wg.Wait()
+}
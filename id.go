@@ -0,0 +1,153 @@
+package boltqueue
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrNotFound is returned when no message with a given ID is waiting in the queue.
+var ErrNotFound = errors.New("Message not found.")
+
+// located is a message that has been found by its ID, along with where it is stored.
+type located struct {
+	m         *Message
+	bucket    *bbolt.Bucket
+	key       []byte // the message's key within the bucket
+	scheduled bool
+}
+
+// find looks up a message that is waiting in the queue or is scheduled. In-flight messages
+// and dead letters are not found.
+func (b *PQueue) find(tx *bbolt.Tx, id uint64) (*located, error) {
+	key := uint64Bytes(id)
+
+	for pri, ok := b.nonEmpty(tx, b.maxPriority); ok; pri, ok = b.nonEmpty(tx, pri-1) {
+		pb := b.bucket(tx, priBytes(pri, b.maxPriority))
+		if pb == nil {
+			continue
+		}
+
+		if v := pb.Get(key); v != nil {
+			m, err := decodeMessage(uint(pri), key, v)
+			if err != nil {
+				return nil, err
+			}
+			return &located{m: m, bucket: pb, key: key}, nil
+		}
+	}
+
+	// scheduled messages are ordered by due time, so the bucket must be searched
+	if sb := b.bucket(tx, scheduledBucket); sb != nil {
+		cur := sb.Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if bytes.Equal(k[8:], key) {
+				m, err := decodeEntry(key, v)
+				if err != nil {
+					return nil, err
+				}
+				return &located{m: m, bucket: sb, key: cloneBytes(k), scheduled: true}, nil
+			}
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// store writes the message back where it was found.
+func (l *located) store() error {
+	if l.scheduled {
+		return l.bucket.Put(l.key, encodeEntry(l.m))
+	}
+	return l.bucket.Put(l.key, l.m.encode())
+}
+
+// Get returns the message with the given ID, without removing it. Only messages that are
+// waiting in the queue or are scheduled can be found; otherwise ErrNotFound is returned.
+func (b *PQueue) Get(id uint64) (*Message, error) {
+	var m *Message
+	err := b.view(func(tx *bbolt.Tx) error {
+		l, err := b.find(tx, id)
+		if err != nil {
+			return err
+		}
+		m = l.m
+		return nil
+	})
+	return m, err
+}
+
+// Remove deletes the message with the given ID from the queue, for example to cancel a job.
+// Only messages that are waiting in the queue or are scheduled can be removed; otherwise
+// ErrNotFound is returned.
+func (b *PQueue) Remove(id uint64) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		l, err := b.find(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err = l.bucket.Delete(l.key); err != nil {
+			return err
+		}
+		if l.scheduled {
+			return nil
+		}
+		return b.dropped(tx, l.m)
+	})
+}
+
+// UpdateValue replaces the value of the message with the given ID. The message keeps its
+// place in the queue. Only messages that are waiting in the queue or are scheduled can be
+// updated; otherwise ErrNotFound is returned.
+func (b *PQueue) UpdateValue(id uint64, value []byte) error {
+	return b.update(func(tx *bbolt.Tx) error {
+		l, err := b.find(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if !l.scheduled {
+			err = b.count(tx, int64(l.m.priority), 0, int64(len(value)-len(l.m.value)))
+			if err != nil {
+				return err
+			}
+		}
+
+		l.m.value = value
+		return l.store()
+	})
+}
+
+// Reprioritize moves the message with the given ID to a different priority, for example to
+// escalate a job. As with Requeue, the message dequeues before newer messages of its new
+// priority. Only messages that are waiting in the queue or are scheduled can be moved;
+// otherwise ErrNotFound is returned.
+func (b *PQueue) Reprioritize(id uint64, priority uint) error {
+	ipri := int64(priority)
+	if ipri > b.maxPriority {
+		return fmt.Errorf("Invalid priority %d on Reprioritize", priority)
+	}
+
+	return b.update(func(tx *bbolt.Tx) error {
+		l, err := b.find(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if l.scheduled {
+			l.m.priority = priority
+			return l.store()
+		}
+
+		if err = l.bucket.Delete(l.key); err != nil {
+			return err
+		}
+		if err = b.dropped(tx, l.m); err != nil {
+			return err
+		}
+		return b.put(tx, ipri, l.m.key, l.m)
+	})
+}
@@ -0,0 +1,93 @@
+package boltqueue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMessageIDs(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	a, b, c := NewMessage("a"), NewMessage("b"), NewMessage("c")
+	if a.ID() != 0 {
+		t.Errorf("Expected no ID before Enqueue. Got: %d", a.ID())
+	}
+	testPQueue.Enqueue(one, a)
+	testPQueue.Enqueue(one, b)
+	testPQueue.Enqueue(one, c)
+	if a.ID() == 0 || b.ID() <= a.ID() || c.ID() <= b.ID() {
+		t.Errorf("Expected increasing IDs. Got: %d, %d, %d", a.ID(), b.ID(), c.ID())
+	}
+
+	m, err := testPQueue.Get(b.ID())
+	if err != nil {
+		t.Fatal(err)
+	} else if m.String() != "b" || m.Priority() != one || m.ID() != b.ID() {
+		t.Errorf("Expected: \"b\" at %d, got: \"%s\" at %d", one, m.String(), m.Priority())
+	}
+
+	if err = testPQueue.UpdateValue(b.ID(), []byte("B")); err != nil {
+		t.Fatal(err)
+	}
+	if err = testPQueue.Reprioritize(c.ID(), five); err != nil {
+		t.Fatal(err)
+	}
+	if err = testPQueue.Remove(a.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if testPQueue.ApproxSize() != 2 {
+		t.Errorf("Expected total size 2. Got: %d", testPQueue.ApproxSize())
+	}
+
+	for _, expected := range []string{"c", "B"} {
+		m, err := testPQueue.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		} else if m.String() != expected {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected, m.String())
+		}
+	}
+
+	if _, err = testPQueue.Get(a.ID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound. Got: %v", err)
+	}
+	if err = testPQueue.Remove(c.ID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound. Got: %v", err)
+	}
+}
+
+func TestScheduledMessageIDs(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	m := NewMessage("later")
+	testPQueue.EnqueueAfter(one, time.Hour, m)
+	if m.ID() == 0 {
+		t.Fatal("Expected an ID")
+	}
+
+	if err = testPQueue.Reprioritize(m.ID(), five); err != nil {
+		t.Fatal(err)
+	}
+	got, err := testPQueue.Get(m.ID())
+	if err != nil {
+		t.Fatal(err)
+	} else if got.Priority() != five {
+		t.Errorf("Expected priority %d. Got: %d", five, got.Priority())
+	}
+
+	if err = testPQueue.Remove(m.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := testPQueue.ScheduledSize(); s != 0 {
+		t.Errorf("Expected no scheduled messages. Got: %d", s)
+	}
+}
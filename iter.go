@@ -0,0 +1,76 @@
+package boltqueue
+
+import (
+	"fmt"
+	"iter"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// All iterates over the queued messages in dequeue order, without removing them. The
+// iteration sees a consistent snapshot of the queue, held in a read-only transaction.
+// Because the transaction is held throughout, the loop body must not modify the queue.
+//
+// Any error ends the iteration; it is yielded with a nil message.
+func (b *PQueue) All() iter.Seq2[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		err := b.view(func(tx *bbolt.Tx) error {
+			now := time.Now()
+			return b.scan(tx, func(m *Message) (bool, error) {
+				if m.Expired(now) {
+					return true, nil
+				}
+				return yield(m, nil), nil
+			})
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// AtPriority iterates over the queued messages of a given priority in dequeue order,
+// without removing them. As for All, the loop body must not modify the queue.
+func (b *PQueue) AtPriority(priority uint) iter.Seq2[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		ipri := int64(priority)
+		if ipri > b.maxPriority {
+			yield(nil, fmt.Errorf("Invalid priority %d for AtPriority()", priority))
+			return
+		}
+
+		err := b.view(func(tx *bbolt.Tx) error {
+			now := time.Now()
+			return b.scanPriority(tx, ipri, func(m *Message) (bool, error) {
+				if m.Expired(now) {
+					return true, nil
+				}
+				return yield(m, nil), nil
+			})
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Drain iterates over the queue, removing each message as it goes, until the queue is
+// empty. Each message is removed just before it is yielded, so breaking out of the loop
+// leaves the rest of the queue intact. Unlike All, the loop body may modify the queue.
+//
+// Any error ends the iteration; it is yielded with a nil message.
+func (b *PQueue) Drain() iter.Seq2[*Message, error] {
+	return func(yield func(*Message, error) bool) {
+		for {
+			m, err := b.Dequeue()
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if m == nil || !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
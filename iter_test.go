@@ -0,0 +1,85 @@
+package boltqueue
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIterators(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	for p := one; p <= five; p++ {
+		for n := 1; n <= 2; n++ {
+			testPQueue.Enqueue(p, NewMessagef("test message %d-%d", p, n))
+		}
+	}
+
+	var all []string
+	for m, err := range testPQueue.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, m.String())
+	}
+
+	if len(all) != 10 || all[0] != "test message 5-1" || all[9] != "test message 1-2" {
+		t.Errorf("Unexpected messages: %v", all)
+	}
+
+	n := 0
+	for m, err := range testPQueue.AtPriority(3) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+		mStrComp := fmt.Sprintf("test message 3-%d", n)
+		if m.String() != mStrComp {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", mStrComp, m.String())
+		}
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 messages. Got: %d", n)
+	}
+
+	for _, err := range testPQueue.AtPriority(10) {
+		if err == nil {
+			t.Error("Expected an error")
+		}
+	}
+
+	i := 0
+	for m, err := range testPQueue.Drain() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.String() != all[i] {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", all[i], m.String())
+		}
+		i++
+		if i == 4 {
+			break
+		}
+	}
+
+	if testPQueue.ApproxSize() != 6 {
+		t.Errorf("Expected total size 6. Got: %d", testPQueue.ApproxSize())
+	}
+
+	for m, err := range testPQueue.Drain() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.String() != all[i] {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", all[i], m.String())
+		}
+		i++
+	}
+
+	if i != 10 {
+		t.Errorf("Expected 10 messages. Got: %d", i)
+	}
+}
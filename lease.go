@@ -0,0 +1,164 @@
+package boltqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrLeaseExpired is returned by Ack and Nack when the message is no longer in-flight.
+// This happens when its lease timed out and it was put back into the queue, or when it
+// has already been acknowledged.
+var ErrLeaseExpired = errors.New("Lease has expired or the message was already acknowledged.")
+
+// inflightBucket holds leased messages. Its name is longer than any priority bucket name
+// so the two can never collide. Its keys are the lease deadline followed by the message
+// key, so that expired leases are always found at the start.
+var inflightBucket = []byte("boltqueue.inflight")
+
+// DequeueLease removes the oldest, highest priority message from the queue and returns it,
+// holding it in-flight until it is acknowledged using Ack. If it is neither acknowledged
+// nor rejected using Nack before the timeout elapses, it reappears in the queue at its
+// original priority, keeping its precedence as for Requeue. This happens in the background,
+// so it does not depend on further calls to Dequeue.
+// If there are no messages available, nil, nil will be returned.
+func (b *PQueue) DequeueLease(timeout time.Duration) (*Message, error) {
+	var m *Message
+
+	err := b.update(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		if err := b.housekeep(tx, now); err != nil {
+			return err
+		}
+
+		var err error
+		m, err = b.take(tx, now)
+		if m == nil || err != nil {
+			return err
+		}
+
+		ib, err := b.createBucket(tx, inflightBucket)
+		if err != nil {
+			return err
+		}
+
+		m.deadline = now.Add(timeout)
+		return ib.Put(timedKey(m.deadline, m.key), encodeEntry(m))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		b.reschedule()
+	}
+	return m, nil
+}
+
+// Ack acknowledges a message obtained from DequeueLease, removing it permanently.
+func (b *PQueue) Ack(m *Message) error {
+	if m.deadline.IsZero() {
+		return ErrLeaseExpired
+	}
+
+	return b.update(func(tx *bbolt.Tx) error {
+		_, err := b.release(tx, m)
+		return err
+	})
+}
+
+// Nack rejects a message obtained from DequeueLease, putting it back into the queue
+// immediately at its original priority. It keeps its precedence as for Requeue.
+// However, if MaxAttempts has been reached, the message is moved to the dead-letter
+// store instead.
+func (b *PQueue) Nack(m *Message) error {
+	if m.deadline.IsZero() {
+		return ErrLeaseExpired
+	}
+
+	return b.update(func(tx *bbolt.Tx) error {
+		leased, err := b.release(tx, m)
+		if err != nil {
+			return err
+		}
+		return b.restore(tx, leased)
+	})
+}
+
+// InFlightSize returns the number of leased messages that have been neither acknowledged
+// nor put back into the queue.
+func (b *PQueue) InFlightSize() (int, error) {
+	count := 0
+	err := b.view(func(tx *bbolt.Tx) error {
+		if ib := b.bucket(tx, inflightBucket); ib != nil {
+			count = ib.Stats().KeyN
+		}
+		return nil
+	})
+	return count, err
+}
+
+// release deletes the in-flight record for a leased message and returns the message
+// as it was stored.
+func (b *PQueue) release(tx *bbolt.Tx, m *Message) (*Message, error) {
+	ib := b.bucket(tx, inflightBucket)
+	if ib == nil {
+		return nil, ErrLeaseExpired
+	}
+
+	lk := timedKey(m.deadline, m.key)
+	v := ib.Get(lk)
+	if v == nil {
+		return nil, ErrLeaseExpired
+	}
+
+	leased, err := decodeEntry(m.key, v)
+	if err != nil {
+		return nil, err
+	}
+	return leased, ib.Delete(lk)
+}
+
+// restore puts a message that was leased back into the queue, unless it has used up
+// its delivery attempts, in which case it becomes a dead letter.
+func (b *PQueue) restore(tx *bbolt.Tx, m *Message) error {
+	if b.MaxAttempts > 0 && m.attempts >= b.MaxAttempts {
+		return b.bury(tx, m)
+	}
+	return b.put(tx, int64(m.priority), m.key, m)
+}
+
+// restoreExpiredLeases puts back into the queue all in-flight messages whose lease
+// deadline has passed.
+func (b *PQueue) restoreExpiredLeases(tx *bbolt.Tx, now time.Time) error {
+	ib := b.bucket(tx, inflightBucket)
+	if ib == nil {
+		return nil
+	}
+
+	limit := uint64(now.UnixNano())
+	cur := ib.Cursor()
+	for k, v := cur.First(); k != nil && binary.BigEndian.Uint64(k) <= limit; k, v = cur.First() {
+		// the message key follows the deadline
+		leased, err := decodeEntry(k[8:], v)
+		if err != nil {
+			return err
+		}
+		if err := cur.Delete(); err != nil {
+			return err
+		}
+		if err := b.restore(tx, leased); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timedKey prefixes a message key with a time, for buckets that are ordered by time.
+func timedKey(t time.Time, key []byte) []byte {
+	tk := make([]byte, 8, 8+len(key))
+	binary.BigEndian.PutUint64(tk, uint64(t.UnixNano()))
+	return append(tk, key...)
+}
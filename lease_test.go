@@ -0,0 +1,159 @@
+package boltqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDequeueLeaseAck(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	for p := one; p <= five; p++ {
+		err := testPQueue.Enqueue(p, NewMessagef("test message %d", p))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	m, err := testPQueue.DequeueLease(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	} else if m.String() != "test message 5" {
+		t.Errorf("Expected: \"%s\", got: \"%s\"", "test message 5", m.String())
+	}
+
+	if n, _ := testPQueue.InFlightSize(); n != 1 {
+		t.Errorf("Expected in-flight size 1. Got: %d", n)
+	}
+
+	err = testPQueue.Ack(m)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n, _ := testPQueue.InFlightSize(); n != 0 {
+		t.Errorf("Expected in-flight size 0. Got: %d", n)
+	}
+
+	err = testPQueue.Ack(m)
+	if err != ErrLeaseExpired {
+		t.Errorf("Expected ErrLeaseExpired. Got: %v", err)
+	}
+
+	if testPQueue.ApproxSize() != 4 {
+		t.Errorf("Expected total size 4. Got: %d", testPQueue.ApproxSize())
+	}
+}
+
+func TestDequeueLeaseNack(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	for n := 1; n <= 3; n++ {
+		err := testPQueue.Enqueue(five, NewMessagef("test message %d", n))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	m, err := testPQueue.DequeueLease(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testPQueue.Nack(m)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// the rejected message keeps its precedence
+	m, err = testPQueue.Dequeue()
+	if err != nil {
+		t.Error(err)
+	} else if m.String() != "test message 1" || m.Priority() != five {
+		t.Errorf("Expected: \"%s\" at %d, got: \"%s\" at %d", "test message 1", five, m.String(), m.Priority())
+	}
+}
+
+func TestDequeueLeaseTimeout(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.EnqueueString(one, "test message 1")
+	testPQueue.EnqueueString(five, "test message 5")
+	testPQueue.EnqueueString(five, "test message 6")
+
+	m, err := testPQueue.DequeueLease(10 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// the expired lease puts the message back at its original priority
+	m2, err := testPQueue.DequeueLease(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	} else if m2.String() != "test message 5" || m2.Priority() != five {
+		t.Errorf("Expected: \"%s\" at %d, got: \"%s\" at %d", "test message 5", five, m2.String(), m2.Priority())
+	}
+
+	err = testPQueue.Ack(m)
+	if err != ErrLeaseExpired {
+		t.Errorf("Expected ErrLeaseExpired. Got: %v", err)
+	}
+
+	err = testPQueue.Ack(m2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if testPQueue.ApproxSize() != 2 {
+		t.Errorf("Expected total size 2. Got: %d", testPQueue.ApproxSize())
+	}
+}
+
+func TestLeaseExpiresWithoutDequeue(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.EnqueueString(five, "test message")
+	if _, err = testPQueue.DequeueLease(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := testPQueue.Len(); n != 0 {
+		t.Errorf("Expected length 0. Got: %d", n)
+	}
+
+	// the message reappears without any further dequeues
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if n, _ := testPQueue.Len(); n == 1 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("Expected length 1. Got: %d", n)
+		}
+	}
+
+	m, err := testPQueue.Peek()
+	if err != nil {
+		t.Fatal(err)
+	} else if m == nil || m.String() != "test message" || m.Priority() != five {
+		t.Errorf("Expected: \"%s\" at %d, got: %v", "test message", five, m)
+	}
+	if n, _ := testPQueue.InFlightSize(); n != 0 {
+		t.Errorf("Expected in-flight size 0. Got: %d", n)
+	}
+}
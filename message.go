@@ -2,8 +2,10 @@ package boltqueue
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"fmt"
+	"time"
 )
 
 // Message represents a message in the priority queue
@@ -11,6 +13,12 @@ type Message struct {
 	key      []byte
 	value    []byte
 	priority uint
+	attempts int
+	ttl      time.Duration
+	expires  time.Time
+	enqueued time.Time
+	headers  map[string]string
+	deadline time.Time // set while the message is leased
 }
 
 // NewMessagef generates a new priority queue message from a formatted string.
@@ -26,7 +34,7 @@ func NewMessage(value string) *Message {
 
 // NewGobMessage generates a new priority queue message from a value via gob
 // encoding. Any error results in a panic (usually arising due to missing gob
-// type registration).
+// type registration). TypedPQueue with GobCodec is an alternative that returns errors instead.
 func NewGobMessage(value interface{}) *Message {
 	b := &bytes.Buffer{}
 	err := gob.NewEncoder(b).Encode(value)
@@ -39,7 +47,7 @@ func NewGobMessage(value interface{}) *Message {
 // WrapBytes generates a new priority queue message.
 // Do not modify the source value after submitting the message.
 func WrapBytes(value []byte) *Message {
-	return &Message{nil, value, 0}
+	return &Message{value: value}
 }
 
 // Priority returns the priority the message had in the queue.
@@ -47,6 +55,88 @@ func (m *Message) Priority() uint {
 	return m.priority
 }
 
+// ID returns the identifier that the queue assigned to the message, which is set by
+// Enqueue and its variants. The message keeps its ID until it leaves the queue, even when
+// it is leased, requeued or dead-lettered. IDs are unique within each queue. Zero means that
+// the message has not been enqueued.
+func (m *Message) ID() uint64 {
+	if len(m.key) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(m.key)
+}
+
+// WithHeader sets a header on the message. Headers are name/value pairs that are
+// stored with the message, such as trace IDs or content types.
+func (m *Message) WithHeader(name, value string) *Message {
+	if m.headers == nil {
+		m.headers = make(map[string]string)
+	}
+	m.headers[name] = value
+	return m
+}
+
+// Header returns the value of a header, or "" if it has not been set.
+func (m *Message) Header(name string) string {
+	return m.headers[name]
+}
+
+// Headers returns a copy of all the message's headers.
+func (m *Message) Headers() map[string]string {
+	headers := make(map[string]string, len(m.headers))
+	for name, value := range m.headers {
+		headers[name] = value
+	}
+	return headers
+}
+
+// EnqueuedAt returns the time when the message was first enqueued. This is zero for
+// messages that have not been enqueued, and for messages enqueued by versions of this
+// package that did not record it.
+func (m *Message) EnqueuedAt() time.Time {
+	return m.enqueued
+}
+
+// stamp sets the times of a message that is being enqueued for the first time.
+func (m *Message) stamp(now time.Time) {
+	if m.enqueued.IsZero() {
+		m.enqueued = now
+	}
+	if m.ttl > 0 && m.expires.IsZero() {
+		m.expires = now.Add(m.ttl)
+	}
+}
+
+// WithTTL sets the time-to-live of the message, counted from when it is enqueued.
+// Once expired, it will be discarded instead of being dequeued.
+func (m *Message) WithTTL(ttl time.Duration) *Message {
+	m.ttl = ttl
+	return m
+}
+
+// ExpiresAt returns the time when the message expires. It is zero for messages
+// that never expire and for messages with a TTL that have not yet been enqueued.
+func (m *Message) ExpiresAt() time.Time {
+	return m.expires
+}
+
+// Expired tests whether the message had expired at a given time.
+func (m *Message) Expired(now time.Time) bool {
+	return !m.expires.IsZero() && !now.Before(m.expires)
+}
+
+// Attempts returns the number of times the message has been delivered by Dequeue or
+// DequeueLease, including the delivery that returned it.
+func (m *Message) Attempts() int {
+	return m.attempts
+}
+
+// LeaseDeadline returns the time by which a message obtained from DequeueLease must be
+// acknowledged. It is zero for messages that are not leased.
+func (m *Message) LeaseDeadline() time.Time {
+	return m.deadline
+}
+
 // String outputs the string representation of the message's value.
 func (m *Message) String() string {
 	return string(m.value)
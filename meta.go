@@ -0,0 +1,307 @@
+package boltqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrPriorityMismatch is returned when a queue is opened with a different number of
+// priorities from the number it was created with. See MigratePriorities.
+var ErrPriorityMismatch = errors.New("Priority range does not match the queue.")
+
+// formatVersion identifies the layout of the queue's buckets and their contents.
+//
+//	0 - bare values in the priority buckets (no metadata bucket)
+//	1 - values are wrapped in envelopes
+//	2 - the metadata bucket records the priority range and key width
+//	3 - message keys are allocated from the metadata bucket's sequence
+//	4 - the metadata bucket counts the messages at each priority
+//	5 - the metadata bucket totals the size of the messages' values
+//	6 - the priority bucket names are wide enough for the highest priority
+const formatVersion = 6
+
+// metaBucket holds information about the queue itself.
+var metaBucket = []byte("boltqueue.meta")
+
+var (
+	versionKey    = []byte("version")
+	prioritiesKey = []byte("priorities")
+	keyWidthKey   = []byte("keywidth")
+)
+
+// upgrade checks the format of the queue's buckets, migrating older formats
+// to the current one, and validates the priority range.
+func (b *PQueue) upgrade(tx *bbolt.Tx) error {
+	mb := b.bucket(tx, metaBucket)
+
+	version := uint64(0)
+	if mb != nil {
+		v := mb.Get(versionKey)
+		if len(v) != 8 {
+			return fmt.Errorf("Missing or invalid format version")
+		}
+		version = binary.BigEndian.Uint64(v)
+	}
+
+	if version > formatVersion {
+		return fmt.Errorf("Unsupported format version %d; upgrade to a newer boltqueue", version)
+	}
+
+	if version < 2 && b.maxPriority < 0 {
+		return fmt.Errorf("The number of priorities must be specified for a new queue")
+	}
+
+	mb, err := b.createBucket(tx, metaBucket)
+	if err != nil {
+		return err
+	}
+
+	if version < 2 {
+		// older formats named the buckets of 257, 65537 etc priorities too narrowly
+		if err = b.putPriorities(mb, len(priBytes(0, b.maxPriority-1))); err != nil {
+			return err
+		}
+	}
+
+	if err = b.checkPriorities(mb); err != nil {
+		return err
+	}
+
+	widened := false
+	if version < 6 {
+		if widened, err = b.widenPriorities(tx, mb); err != nil {
+			return err
+		}
+	}
+
+	if err = b.checkKeyWidth(mb); err != nil {
+		return err
+	}
+
+	if version == 0 {
+		if err = b.migrateBareValues(tx); err != nil {
+			return err
+		}
+	}
+
+	if version < 3 {
+		if err = b.seedKeys(tx, mb); err != nil {
+			return err
+		}
+	}
+
+	if version < 5 || widened {
+		if err = b.recount(tx); err != nil {
+			return err
+		}
+	}
+
+	if version < formatVersion {
+		return mb.Put(versionKey, uint64Bytes(formatVersion))
+	}
+	return nil
+}
+
+// validate checks that a read-only queue has the current format, and validates the
+// priority range.
+func (b *PQueue) validate(tx *bbolt.Tx) error {
+	mb := b.bucket(tx, metaBucket)
+	if mb == nil {
+		return fmt.Errorf("Not a queue, or an older format that must first be opened for writing")
+	}
+
+	version := getUint64(mb.Get(versionKey))
+	if version > formatVersion {
+		return fmt.Errorf("Unsupported format version %d; upgrade to a newer boltqueue", version)
+	} else if version < formatVersion {
+		return fmt.Errorf("Format version %d must first be opened for writing", version)
+	}
+	if err := b.checkPriorities(mb); err != nil {
+		return err
+	}
+	return b.checkKeyWidth(mb)
+}
+
+// putPriorities records the priority range and the width of the priority buckets' names.
+func (b *PQueue) putPriorities(mb *bbolt.Bucket, width int) error {
+	err := mb.Put(prioritiesKey, uint64Bytes(uint64(b.maxPriority+1)))
+	if err != nil {
+		return err
+	}
+	return mb.Put(keyWidthKey, uint64Bytes(uint64(width)))
+}
+
+// checkPriorities validates the priority range against the recorded range, which
+// is adopted if the range was not specified.
+func (b *PQueue) checkPriorities(mb *bbolt.Bucket) error {
+	priorities, width := mb.Get(prioritiesKey), mb.Get(keyWidthKey)
+	if len(priorities) != 8 || len(width) != 8 {
+		return fmt.Errorf("Missing or invalid priority range")
+	}
+
+	recorded := int64(binary.BigEndian.Uint64(priorities))
+	if b.maxPriority < 0 {
+		b.maxPriority = recorded - 1
+	} else if b.maxPriority+1 != recorded {
+		return fmt.Errorf("%w Queue has %d priorities, not %d.", ErrPriorityMismatch, recorded, b.maxPriority+1)
+	}
+
+	return nil
+}
+
+// checkKeyWidth validates the recorded width of the priority buckets' names.
+func (b *PQueue) checkKeyWidth(mb *bbolt.Bucket) error {
+	if w := getUint64(mb.Get(keyWidthKey)); w != uint64(len(priBytes(0, b.maxPriority))) {
+		return fmt.Errorf("Unsupported key width %d for %d priorities", w, b.maxPriority+1)
+	}
+	return nil
+}
+
+// widenPriorities renames the priority buckets if their recorded width is too narrow for
+// the priority range, which happened with 257, 65537 or 4294967297 priorities before
+// version 6. The highest priority did not fit, so its messages shared the bucket of
+// priority zero, where they remain. The counts must then be rebuilt.
+func (b *PQueue) widenPriorities(tx *bbolt.Tx, mb *bbolt.Bucket) (bool, error) {
+	width := getUint64(mb.Get(keyWidthKey))
+	if width == 0 || width >= uint64(len(priBytes(0, b.maxPriority))) {
+		return false, nil
+	}
+
+	// the highest priority that fitted in the recorded width
+	narrow := int64(1)<<(8*width) - 1
+
+	for pri := min(b.maxPriority, narrow); pri >= 0; pri-- {
+		name := priBytes(pri, narrow)
+		old := b.bucket(tx, name)
+		if old == nil {
+			continue
+		}
+
+		pb, err := b.createBucket(tx, priBytes(pri, b.maxPriority))
+		if err != nil {
+			return false, err
+		}
+
+		err = old.ForEach(func(k, v []byte) error {
+			return pb.Put(cloneBytes(k), cloneBytes(v))
+		})
+		if err != nil {
+			return false, err
+		}
+
+		if err = b.deleteBucket(tx, name); err != nil {
+			return false, err
+		}
+	}
+
+	// the expiry index must refer to the buckets where the messages are
+	if eb := b.bucket(tx, expiryBucket); eb != nil {
+		err := rewrite(eb, func(k, v []byte) []byte {
+			return uint64Bytes(binary.BigEndian.Uint64(v) & uint64(narrow))
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, mb.Put(keyWidthKey, uint64Bytes(uint64(len(priBytes(0, b.maxPriority)))))
+}
+
+// nextKey allocates the key for a new message, within an Update transaction. Keys are
+// strictly increasing across restarts and regardless of the system clock.
+func (b *PQueue) nextKey(tx *bbolt.Tx) ([]byte, error) {
+	mb := b.bucket(tx, metaBucket)
+	if mb == nil {
+		return nil, fmt.Errorf("Missing metadata; the queue may have been deleted")
+	}
+
+	seq, err := mb.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	return uint64Bytes(seq), nil
+}
+
+// seedKeys sets the key sequence above every existing message key, which older formats
+// derived from the system clock.
+func (b *PQueue) seedKeys(tx *bbolt.Tx, mb *bbolt.Bucket) error {
+	highest := mb.Sequence()
+	note := func(key []byte) {
+		if len(key) == 8 {
+			highest = max(highest, binary.BigEndian.Uint64(key))
+		}
+	}
+
+	for pri := b.maxPriority; pri >= 0; pri-- {
+		if pb := b.bucket(tx, priBytes(pri, b.maxPriority)); pb != nil {
+			k, _ := pb.Cursor().Last()
+			note(k)
+		}
+	}
+
+	if db := b.bucket(tx, deadLetterBucket); db != nil {
+		k, _ := db.Cursor().Last()
+		note(k)
+	}
+
+	// these are ordered by time, so every key must be examined
+	for _, name := range [][]byte{inflightBucket, scheduledBucket} {
+		if bucket := b.bucket(tx, name); bucket != nil {
+			bucket.ForEach(func(k, v []byte) error {
+				note(k[8:])
+				return nil
+			})
+		}
+	}
+
+	return mb.SetSequence(highest)
+}
+
+// migrateBareValues wraps the values held by a version 0 queue in envelopes.
+func (b *PQueue) migrateBareValues(tx *bbolt.Tx) error {
+	for pri := b.maxPriority; pri >= 0; pri-- {
+		pb := b.bucket(tx, priBytes(pri, b.maxPriority))
+		if pb == nil {
+			continue
+		}
+
+		err := rewrite(pb, func(k, v []byte) []byte {
+			return WrapBytes(v).encode()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if ib := b.bucket(tx, inflightBucket); ib != nil {
+		return rewrite(ib, func(k, v []byte) []byte {
+			m := WrapBytes(v[8:])
+			m.priority = uint(binary.BigEndian.Uint64(v))
+			return encodeEntry(m)
+		})
+	}
+	return nil
+}
+
+// rewrite replaces every value in a bucket.
+func rewrite(bucket *bbolt.Bucket, fn func(k, v []byte) []byte) error {
+	cur := bucket.Cursor()
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		key := cloneBytes(k)
+		if err := bucket.Put(key, fn(k, v)); err != nil {
+			return err
+		}
+		// the cursor must be repositioned after the bucket has been modified
+		cur.Seek(key)
+	}
+	return nil
+}
+
+func uint64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,127 @@
+package boltqueue
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// migratingBucket temporarily holds messages while they are moved between priorities.
+var migratingBucket = []byte("boltqueue.migrating")
+
+// MigratePriorities changes the queue's priority range, moving every message to a new
+// priority given by the remap function. If remap is nil, priorities beyond the new range
+// are reduced to the new maximum and all others are unchanged. Messages keep their
+// precedence within each priority.
+//
+// This applies to in-flight messages, scheduled messages and dead letters as well as to
+// those waiting in the queue. It happens in a single transaction. The queue must not be
+// used concurrently.
+func (b *PQueue) MigratePriorities(priorities uint, remap func(uint) uint) error {
+	if priorities == 0 {
+		return fmt.Errorf("The number of priorities must be specified")
+	}
+
+	oldMax, newMax := b.maxPriority, int64(priorities)-1
+	if remap == nil {
+		remap = func(p uint) uint {
+			return min(p, uint(newMax))
+		}
+	}
+
+	mapping := make([]uint64, oldMax+1)
+	for pri := range mapping {
+		p := remap(uint(pri))
+		if int64(p) > newMax {
+			return fmt.Errorf("Invalid priority %d for priority %d on MigratePriorities", p, pri)
+		}
+		mapping[pri] = uint64(p)
+	}
+
+	// rewrites the priority at the start of an entry
+	remapEntry := func(k, v []byte) []byte {
+		e := cloneBytes(v)
+		binary.BigEndian.PutUint64(e, mapping[binary.BigEndian.Uint64(e)])
+		return e
+	}
+
+	err := b.update(func(tx *bbolt.Tx) error {
+		tmp, err := b.createBucket(tx, migratingBucket)
+		if err != nil {
+			return err
+		}
+
+		// the old and new bucket names may overlap, so all messages are taken out first
+		for pri := oldMax; pri >= 0; pri-- {
+			name := priBytes(pri, oldMax)
+			pb := b.bucket(tx, name)
+			if pb == nil {
+				continue
+			}
+
+			err = pb.ForEach(func(k, v []byte) error {
+				m, err := decodeMessage(uint(pri), k, v)
+				if err != nil {
+					return err
+				}
+				tx.OnCommit(b.removed)
+				m.priority = uint(mapping[pri])
+				return tmp.Put(k, encodeEntry(m))
+			})
+			if err != nil {
+				return err
+			}
+
+			if err = b.deleteBucket(tx, name); err != nil {
+				return err
+			}
+		}
+
+		// the expiry index and the counts are rebuilt as the messages are put back
+		if b.bucket(tx, expiryBucket) != nil {
+			if err = b.deleteBucket(tx, expiryBucket); err != nil {
+				return err
+			}
+		}
+		if err = b.resetCounts(tx); err != nil {
+			return err
+		}
+
+		b.maxPriority = newMax
+
+		err = tmp.ForEach(func(k, v []byte) error {
+			m, err := decodeEntry(k, v)
+			if err != nil {
+				return err
+			}
+			return b.put(tx, int64(m.priority), m.key, m)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = b.deleteBucket(tx, migratingBucket); err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{inflightBucket, scheduledBucket, deadLetterBucket} {
+			if bucket := b.bucket(tx, name); bucket != nil {
+				if err = rewrite(bucket, remapEntry); err != nil {
+					return err
+				}
+			}
+		}
+
+		mb, err := b.createBucket(tx, metaBucket)
+		if err != nil {
+			return err
+		}
+		return b.putPriorities(mb, len(priBytes(0, b.maxPriority)))
+	})
+
+	if err != nil {
+		b.maxPriority = oldMax
+	}
+	return err
+}
@@ -0,0 +1,238 @@
+package boltqueue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestReopenWithDifferentPriorities(t *testing.T) {
+	testPQueue, err := NewPQueue("testPriorities.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+	testPQueue.EnqueueString(five, "test message 5")
+	testPQueue.Close()
+
+	_, err = NewPQueue("testPriorities.db", 300)
+	if !errors.Is(err, ErrPriorityMismatch) {
+		t.Errorf("Expected ErrPriorityMismatch. Got: %v", err)
+	}
+
+	// zero means use the recorded range
+	testPQueue, err = NewPQueue("testPriorities.db", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	if s, _ := testPQueue.Size(five); s != 1 {
+		t.Errorf("Expected queue size 1 for priority %d. Got: %d", five, s)
+	}
+}
+
+func TestMigratePriorities(t *testing.T) {
+	testPQueue, err := NewPQueue("testPriorities.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+
+	for p := zero; p < 10; p++ {
+		testPQueue.EnqueueString(p, "a")
+		testPQueue.EnqueueString(p, "b")
+	}
+	testPQueue.Enqueue(9, NewMessage("c").WithTTL(time.Hour))
+	testPQueue.EnqueueAfter(7, time.Hour, NewMessage("d"))
+
+	// widen the range past 256 so the bucket names change too
+	err = testPQueue.MigratePriorities(1000, func(p uint) uint {
+		return p * 100
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if testPQueue.ApproxSize() != 21 {
+		t.Errorf("Expected total size 21. Got: %d", testPQueue.ApproxSize())
+	}
+	testPQueue.Close()
+
+	testPQueue, err = NewPQueue("testPriorities.db", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	if s, _ := testPQueue.TotalSize(); s != 21 {
+		t.Errorf("Expected total size 21. Got: %d", s)
+	}
+
+	for p := 9; p >= 0; p-- {
+		expected := []string{"a", "b"}
+		if p == 9 {
+			expected = append(expected, "c")
+		}
+		for _, e := range expected {
+			m, err := testPQueue.Dequeue()
+			if err != nil {
+				t.Fatal(err)
+			} else if m.String() != e || m.Priority() != uint(p*100) {
+				t.Errorf("Expected: \"%s\" at %d, got: \"%s\" at %d", e, p*100, m.String(), m.Priority())
+			}
+		}
+	}
+
+	list, _ := testPQueue.PeekN(1)
+	if len(list) != 0 {
+		t.Errorf("Expected no more messages. Got: %d", len(list))
+	}
+
+	err = testPQueue.MigratePriorities(10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the scheduled message has been clamped to the new range
+	err = testPQueue.conn.Update(func(tx *bbolt.Tx) error {
+		return testPQueue.promoteDue(tx, time.Now().Add(2*time.Hour))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := testPQueue.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	} else if m.String() != "d" || m.Priority() != 9 {
+		t.Errorf("Expected: \"d\" at 9, got: \"%s\" at %d", m.String(), m.Priority())
+	}
+}
+
+func TestKeysAfterClockStepsBack(t *testing.T) {
+	testPQueue, err := NewPQueue("testKeys.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+	testPQueue.EnqueueString(five, "first")
+
+	// an older format queue derived its keys from a clock that has since stepped back
+	err = testPQueue.conn.Update(func(tx *bbolt.Tx) error {
+		key := uint64Bytes(uint64(time.Now().Add(time.Hour).UnixNano()))
+		err := tx.Bucket(priBytes(5, 9)).Put(key, NewMessage("second").encode())
+		if err != nil {
+			return err
+		}
+		mb := tx.Bucket(metaBucket)
+		if err = mb.SetSequence(0); err != nil {
+			return err
+		}
+		return mb.Put(versionKey, uint64Bytes(2))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.Close()
+
+	for _, s := range []string{"third", "fourth"} {
+		testPQueue, err = NewPQueue("testKeys.db", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testPQueue.RetainOnClose = true
+		testPQueue.EnqueueString(five, s)
+		testPQueue.Close()
+	}
+
+	testPQueue, err = NewPQueue("testKeys.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	for _, expected := range []string{"first", "second", "third", "fourth"} {
+		s, err := testPQueue.DequeueString()
+		if err != nil {
+			t.Fatal(err)
+		} else if s != expected {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected, s)
+		}
+	}
+}
+
+func TestWidenPriorities(t *testing.T) {
+	testPQueue, err := NewPQueue("testWiden.db", 257)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+	testPQueue.EnqueueString(zero, "a")
+	testPQueue.EnqueueString(five, "b")
+	testPQueue.Enqueue(256, NewMessage("c").WithTTL(time.Hour))
+
+	// version 5 named the buckets of 257 priorities with one byte, so 256 shared 0's bucket
+	err = testPQueue.conn.Update(func(tx *bbolt.Tx) error {
+		for _, p := range []int64{256, 5, 0} {
+			wide := tx.Bucket(priBytes(p, 256))
+			narrow, err := tx.CreateBucketIfNotExists([]byte{byte(p)})
+			if err != nil {
+				return err
+			}
+			if err = wide.ForEach(func(k, v []byte) error {
+				return narrow.Put(cloneBytes(k), cloneBytes(v))
+			}); err != nil {
+				return err
+			}
+			if err = tx.DeleteBucket(priBytes(p, 256)); err != nil {
+				return err
+			}
+		}
+		mb := tx.Bucket(metaBucket)
+		if err := mb.Put(keyWidthKey, uint64Bytes(1)); err != nil {
+			return err
+		}
+		return mb.Put(versionKey, uint64Bytes(5))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.Close()
+
+	testPQueue, err = NewPQueue("testWiden.db", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	if s, _ := testPQueue.TotalSize(); s != 3 {
+		t.Errorf("Expected total size 3. Got: %d", s)
+	}
+	if s, _ := testPQueue.Size(zero); s != 2 {
+		t.Errorf("Expected queue size 2 for priority %d. Got: %d", zero, s)
+	}
+
+	// the expiry index follows the message
+	n := 0
+	err = testPQueue.conn.Update(func(tx *bbolt.Tx) error {
+		n, err = testPQueue.sweep(tx, time.Now().Add(2*time.Hour))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Errorf("Expected 1 expired message. Got: %d", n)
+	}
+
+	for _, expected := range []string{"b", "a"} {
+		s, err := testPQueue.DequeueString()
+		if err != nil {
+			t.Fatal(err)
+		} else if s != expected {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected, s)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package boltqueue
+
+import (
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrNoSuchQueue is returned when a named queue does not exist.
+var ErrNoSuchQueue = errors.New("No such queue.")
+
+// OpenQueue loads or creates a named queue within a database that can be shared by many
+// queues and by the application's own buckets. All of the queue's buckets are nested
+// within a top-level bucket having the given name.
+// Specify the required range of priorities; available priorities are from 0 (lowest) to
+// the specified number minus one.
+//
+// Closing the queue neither closes the database nor deletes the queue and its messages;
+// use DeleteQueue for that.
+func OpenQueue(db *bbolt.DB, name string, priorities uint) (*PQueue, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Queue name is required")
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(name))
+		if root != nil && root.Bucket(metaBucket) == nil {
+			if k, _ := root.Cursor().First(); k != nil {
+				return fmt.Errorf("Bucket %q is in use but is not a queue", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapDB(db, []byte(name), priorities)
+}
+
+// ListQueues lists the names of the named queues in a database.
+func ListQueues(db *bbolt.DB) ([]string, error) {
+	var names []string
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, root *bbolt.Bucket) error {
+			if root.Bucket(metaBucket) != nil {
+				names = append(names, string(name))
+			}
+			return nil
+		})
+	})
+	return names, err
+}
+
+// DeleteQueue deletes a named queue and all its messages. The queue should not be open.
+func DeleteQueue(db *bbolt.DB, name string) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		if !isQueue(tx, name) {
+			return ErrNoSuchQueue
+		}
+		return tx.DeleteBucket([]byte(name))
+	})
+}
+
+// RenameQueue renames a named queue. The queue should not be open.
+func RenameQueue(db *bbolt.DB, oldName, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("Queue name is required")
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		if !isQueue(tx, oldName) {
+			return ErrNoSuchQueue
+		}
+
+		dst, err := tx.CreateBucket([]byte(newName))
+		if err != nil {
+			return fmt.Errorf("Cannot rename queue %q to %q: %w", oldName, newName, err)
+		}
+
+		if err = copyBucket(dst, tx.Bucket([]byte(oldName))); err != nil {
+			return err
+		}
+		return tx.DeleteBucket([]byte(oldName))
+	})
+}
+
+func isQueue(tx *bbolt.Tx, name string) bool {
+	root := tx.Bucket([]byte(name))
+	return root != nil && root.Bucket(metaBucket) != nil
+}
+
+// copyBucket copies the contents of one bucket to another, including nested buckets.
+func copyBucket(dst, src *bbolt.Bucket) error {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
+
+//-------------------------------------------------------------------------------------------------
+
+// bucket gets one of the queue's buckets, or nil if it does not exist.
+func (b *PQueue) bucket(tx *bbolt.Tx, name []byte) *bbolt.Bucket {
+	if b.name == nil {
+		return tx.Bucket(name)
+	}
+	if root := tx.Bucket(b.name); root != nil {
+		return root.Bucket(name)
+	}
+	return nil
+}
+
+// createBucket gets one of the queue's buckets, creating it if necessary.
+func (b *PQueue) createBucket(tx *bbolt.Tx, name []byte) (*bbolt.Bucket, error) {
+	if b.name == nil {
+		return tx.CreateBucketIfNotExists(name)
+	}
+	root, err := tx.CreateBucketIfNotExists(b.name)
+	if err != nil {
+		return nil, err
+	}
+	return root.CreateBucketIfNotExists(name)
+}
+
+// deleteBucket deletes one of the queue's buckets.
+func (b *PQueue) deleteBucket(tx *bbolt.Tx, name []byte) error {
+	if b.name == nil {
+		return tx.DeleteBucket(name)
+	}
+	if root := tx.Bucket(b.name); root != nil {
+		return root.DeleteBucket(name)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package boltqueue
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestNamedQueues(t *testing.T) {
+	db, err := bbolt.Open("testNamed.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testNamed.db")
+	defer db.Close()
+
+	// the application's own bucket
+	err = db.Update(func(tx *bbolt.Tx) error {
+		app, err := tx.CreateBucket([]byte("app"))
+		if err != nil {
+			return err
+		}
+		return app.Put([]byte("k"), []byte("v"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	red, err := OpenQueue(db, "red", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blue, err := OpenQueue(db, "blue", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	red.EnqueueString(five, "red message")
+	blue.EnqueueString(five, "blue message 1")
+	blue.EnqueueString(five, "blue message 2")
+
+	if red.ApproxSize() != 1 || blue.ApproxSize() != 2 {
+		t.Errorf("Expected sizes 1 and 2. Got: %d and %d", red.ApproxSize(), blue.ApproxSize())
+	}
+
+	names, err := ListQueues(db)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(names, []string{"blue", "red"}) {
+		t.Errorf("Expected [blue red]. Got: %v", names)
+	}
+
+	red.Close()
+	blue.Close()
+
+	err = RenameQueue(db, "blue", "green")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DeleteQueue(db, "red")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DeleteQueue(db, "red")
+	if err != ErrNoSuchQueue {
+		t.Errorf("Expected ErrNoSuchQueue. Got: %v", err)
+	}
+
+	names, _ = ListQueues(db)
+	if !reflect.DeepEqual(names, []string{"green"}) {
+		t.Errorf("Expected [green]. Got: %v", names)
+	}
+
+	green, err := OpenQueue(db, "green", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"blue message 1", "blue message 2"} {
+		m, err := green.DequeueString()
+		if err != nil {
+			t.Error(err)
+		} else if m != expected {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected, m)
+		}
+	}
+
+	green.EnqueueString(five, "green message")
+	green.Close()
+
+	// closing keeps the queue and its messages
+	green, err = OpenQueue(db, "green", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := green.Len(); s != 1 {
+		t.Errorf("Expected length 1. Got: %d", s)
+	}
+	green.Close()
+
+	err = DeleteQueue(db, "green")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, _ = ListQueues(db)
+	if len(names) != 0 {
+		t.Errorf("Expected no queues. Got: %v", names)
+	}
+
+	_, err = OpenQueue(db, "app", 10)
+	if err == nil {
+		t.Errorf("Expected application bucket not to be usable as a queue")
+	}
+}
@@ -0,0 +1,112 @@
+package boltqueue
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Options control how NewPQueueWithOptions opens the database. The zero value gives the
+// same behaviour as NewPQueue.
+type Options struct {
+	// FileMode sets the permissions of a new database file. Zero means 0600.
+	FileMode os.FileMode
+
+	// Timeout limits how long to wait for the lock on the database file, which is held by
+	// any other process that has the file open. If the lock cannot be obtained in time,
+	// bbolt.ErrTimeout is returned. Zero means wait indefinitely.
+	Timeout time.Duration
+
+	// NoSync is the same as Unsynced durability.
+	NoSync bool
+
+	// Durability chooses when changes are synced to disk; see SetDurability.
+	Durability Durability
+
+	// SyncInterval is the interval for Periodic durability. Zero means one second.
+	SyncInterval time.Duration
+
+	// NoFreelistSync skips writing the freelist to disk, so commits are faster but opening
+	// the file is slower.
+	NoFreelistSync bool
+
+	// InitialMmapSize is the initial size of the database's memory map, in bytes. Setting
+	// this large enough avoids remapping as the file grows. Zero means bbolt's default.
+	InitialMmapSize int
+
+	// FreelistType chooses bbolt's freelist implementation. Empty means bbolt's default.
+	FreelistType bbolt.FreelistType
+
+	// ReadOnly opens an existing queue without the ability to change it, so that other
+	// read-only processes may open it at the same time. Messages can be inspected using
+	// Peek, All etc, but anything that would change the queue fails. The file is never
+	// deleted by Close. The queue must already use the current format.
+	ReadOnly bool
+
+	// NamePattern is the pattern for the unique filenames generated when the filename
+	// is a directory name ending with '/'. It must contain one %d verb, which is replaced
+	// by the current time. Empty means "pq%d.db".
+	NamePattern string
+}
+
+// NewPQueueWithOptions loads or creates a new PQueue with the given filename, as for
+// NewPQueue, using the given options. Nil options are the same as the zero value.
+func NewPQueueWithOptions(filename string, priorities uint, opts *Options) (*PQueue, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	boltOptions := &bbolt.Options{
+		Timeout:         opts.Timeout,
+		NoSync:          opts.NoSync,
+		NoFreelistSync:  opts.NoFreelistSync,
+		InitialMmapSize: opts.InitialMmapSize,
+		FreelistType:    opts.FreelistType,
+		ReadOnly:        opts.ReadOnly,
+	}
+
+	db, err := bbolt.Open(opts.filename(filename), opts.fileMode(), boltOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := WrapDB(db, priorities)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	q.owned = true
+	q.boltOptions = boltOptions
+
+	durability := opts.Durability
+	if opts.NoSync && durability == Synchronous {
+		durability = Unsynced
+	}
+	if durability != Synchronous && !opts.ReadOnly {
+		q.SetDurability(durability, opts.SyncInterval)
+	}
+	return q, nil
+}
+
+// filename appends a unique filename to a directory name ending with '/'.
+func (opts *Options) filename(name string) string {
+	if !strings.HasSuffix(name, "/") {
+		return name
+	}
+
+	pattern := opts.NamePattern
+	if pattern == "" {
+		pattern = "pq%d.db"
+	}
+	return name + fmt.Sprintf(pattern, time.Now().UnixNano())
+}
+
+func (opts *Options) fileMode() os.FileMode {
+	if opts.FileMode == 0 {
+		return 0600
+	}
+	return opts.FileMode
+}
@@ -0,0 +1,80 @@
+package boltqueue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestNewPQueueWithOptions(t *testing.T) {
+	testPQueue, err := NewPQueueWithOptions("./", 10, &Options{
+		FileMode:    0640,
+		NamePattern: "test%d.queue",
+		NoSync:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	name := filepath.Base(testPQueue.conn.Path())
+	if !strings.HasPrefix(name, "test") || !strings.HasSuffix(name, ".queue") {
+		t.Errorf("Expected a name matching the pattern. Got: %s", name)
+	}
+
+	info, err := os.Stat(testPQueue.conn.Path())
+	if err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640. Got: %v", info.Mode().Perm())
+	}
+
+	// a second opener fails fast
+	_, err = NewPQueueWithOptions(testPQueue.conn.Path(), 10, &Options{Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, bbolt.ErrTimeout) {
+		t.Errorf("Expected bbolt.ErrTimeout. Got: %v", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	testPQueue, err := NewPQueue("testReadOnly.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPQueue.RetainOnClose = true
+	testPQueue.EnqueueString(five, "test message")
+	testPQueue.Close()
+
+	testPQueue, err = NewPQueueWithOptions("testReadOnly.db", 0, &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := testPQueue.Peek()
+	if err != nil {
+		t.Fatal(err)
+	} else if m.String() != "test message" || m.Priority() != five {
+		t.Errorf("Expected: \"%s\" at %d, got: \"%s\" at %d", "test message", five, m.String(), m.Priority())
+	}
+
+	if err = testPQueue.EnqueueString(five, "another"); !errors.Is(err, bbolt.ErrDatabaseReadOnly) {
+		t.Errorf("Expected bbolt.ErrDatabaseReadOnly. Got: %v", err)
+	}
+	testPQueue.Close()
+
+	// the file is kept, so it can be opened for writing and then deleted
+	testPQueue, err = NewPQueue("testReadOnly.db", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	if n, _ := testPQueue.Len(); n != 1 {
+		t.Errorf("Expected length 1. Got: %d", n)
+	}
+}
@@ -0,0 +1,108 @@
+package boltqueue
+
+import (
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Peek returns the message that Dequeue would return next, without removing it.
+// If there are no messages available, nil, nil will be returned.
+func (b *PQueue) Peek() (*Message, error) {
+	list, err := b.PeekN(1)
+	if len(list) == 0 || err != nil {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+// PeekN returns up to n of the messages that Dequeue would return next, in order, without
+// removing them.
+func (b *PQueue) PeekN(n int) ([]*Message, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var list []*Message
+
+	err := b.view(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		return b.scan(tx, func(m *Message) (bool, error) {
+			if !m.Expired(now) {
+				list = append(list, m)
+			}
+			return len(list) < n, nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// PeekPriority returns up to n of the oldest messages of a given priority, in order,
+// without removing them.
+func (b *PQueue) PeekPriority(priority uint, n int) ([]*Message, error) {
+	ipri := int64(priority)
+	if ipri > b.maxPriority {
+		return nil, fmt.Errorf("Invalid priority %d for PeekPriority()", priority)
+	} else if n <= 0 {
+		return nil, nil
+	}
+
+	var list []*Message
+
+	err := b.view(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		return b.scanPriority(tx, ipri, func(m *Message) (bool, error) {
+			if !m.Expired(now) {
+				list = append(list, m)
+			}
+			return len(list) < n, nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// scan visits the queued messages in dequeue order for as long as fn returns true.
+func (b *PQueue) scan(tx *bbolt.Tx, fn func(*Message) (bool, error)) error {
+	more := true
+	for pri, ok := b.nonEmpty(tx, b.maxPriority); ok && more; pri, ok = b.nonEmpty(tx, pri-1) {
+		err := b.scanPriority(tx, pri, func(m *Message) (bool, error) {
+			var err error
+			more, err = fn(m)
+			return more, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPriority visits the queued messages of one priority in dequeue order for as long
+// as fn returns true.
+func (b *PQueue) scanPriority(tx *bbolt.Tx, priority int64, fn func(*Message) (bool, error)) error {
+	bucket := b.bucket(tx, priBytes(priority, b.maxPriority))
+	if bucket == nil {
+		return nil
+	}
+
+	cur := bucket.Cursor()
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		m, err := decodeMessage(uint(priority), k, v)
+		if err != nil {
+			return err
+		}
+		if more, err := fn(m); !more || err != nil {
+			return err
+		}
+	}
+	return nil
+}
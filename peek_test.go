@@ -0,0 +1,77 @@
+package boltqueue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPeek(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	m, err := testPQueue.Peek()
+	if err != nil || m != nil {
+		t.Errorf("Expected nothing. Got: %v, %v", m, err)
+	}
+
+	for p := one; p <= five; p++ {
+		for n := 1; n <= 3; n++ {
+			testPQueue.Enqueue(p, NewMessagef("test message %d-%d", p, n))
+		}
+	}
+	testPQueue.Enqueue(five, NewMessage("stale").WithTTL(time.Nanosecond))
+
+	m, err = testPQueue.Peek()
+	if err != nil {
+		t.Fatal(err)
+	} else if m.String() != "test message 5-1" || m.Priority() != five {
+		t.Errorf("Expected: \"%s\" at %d, got: \"%s\" at %d", "test message 5-1", five, m.String(), m.Priority())
+	}
+
+	list, err := testPQueue.PeekN(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"test message 5-1", "test message 5-2", "test message 5-3", "test message 4-1", "test message 4-2"}
+	for i, m := range list {
+		if m.String() != expected[i] {
+			t.Errorf("Expected: \"%s\", got: \"%s\"", expected[i], m.String())
+		}
+	}
+
+	list, err = testPQueue.PeekPriority(2, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(list) != 3 {
+		t.Errorf("Expected 3 messages. Got: %d", len(list))
+	}
+	for i, m := range list {
+		mStrComp := fmt.Sprintf("test message 2-%d", i+1)
+		if m.String() != mStrComp || m.Priority() != 2 {
+			t.Errorf("Expected: \"%s\" at 2, got: \"%s\" at %d", mStrComp, m.String(), m.Priority())
+		}
+	}
+
+	if list, _ = testPQueue.PeekN(0); len(list) != 0 {
+		t.Errorf("Expected no messages. Got: %d", len(list))
+	}
+	if list, _ = testPQueue.PeekPriority(2, 0); len(list) != 0 {
+		t.Errorf("Expected no messages. Got: %d", len(list))
+	}
+
+	// peeking has not removed anything
+	if s, _ := testPQueue.TotalSize(); s != 16 {
+		t.Errorf("Expected total size 16. Got: %d", s)
+	}
+
+	m2, err := testPQueue.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	} else if m2.String() != m.String() || m2.Priority() != m.Priority() {
+		t.Errorf("Expected: \"%s\", got: \"%s\"", m.String(), m2.String())
+	}
+}
@@ -1,26 +1,62 @@
 package boltqueue
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"go.etcd.io/bbolt"
 	"os"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// aKey singleton for assigning keys to messages
-var aKey = newAtomicKey()
-
 // PQueue is a priority queue backed by a Bolt database on disk
 type PQueue struct {
 	// When RetainOnClose is true, the database file will be preserved after Close() is called.
-	// Normally, the file is deleted on Close().
+	// Normally, the file is deleted on Close(). Named queues are always preserved.
 	RetainOnClose bool
 
-	conn        *bbolt.DB
-	size        int64
-	maxPriority int64
+	// MaxAttempts limits how many times a leased message may be delivered. When a message
+	// that has been delivered this many times is rejected using Nack or its lease expires,
+	// it is moved to the dead-letter store instead of being put back into the queue.
+	// Zero means there is no limit.
+	MaxAttempts int
+
+	// When GroupCommit is true, enqueues from concurrent goroutines are coalesced into
+	// shared transactions so that they share the cost of each disk sync. Every call still
+	// returns only after its message has been committed. This greatly improves throughput
+	// when there are many concurrent producers.
+	GroupCommit bool
+
+	// MaxMessages and MaxBytes limit how many messages may wait in the queue and the total
+	// size of their values. Zero means there is no limit. When a new message would exceed
+	// either limit, the Overflow policy applies. Messages that are scheduled, in-flight
+	// or dead-lettered do not count, and they are never prevented from returning to the
+	// queue, so the limits may sometimes be exceeded.
+	MaxMessages int64
+	MaxBytes    int64
+
+	// Overflow determines what happens when the queue has reached its limit.
+	Overflow OverflowPolicy
+
+	conn          *bbolt.DB
+	connMu        sync.RWMutex   // held exclusively while Compact replaces conn
+	owned         bool           // true if the queue opened its own database file
+	boltOptions   *bbolt.Options // how the queue's own database file was opened
+	name          []byte         // nil unless the queue is nested in a named bucket
+	size          atomic.Int64
+	maxPriority   int64
+	expiryHandler func(*Message)
+	group         coalescer
+	synced        syncState
+
+	ready       signal        // notified when messages become available
+	space       signal        // notified when messages are removed
+	rescheduled chan struct{} // wakes the scheduler
+	closing     chan struct{} // closed to stop background goroutines
+	closeOnce   sync.Once
+	background  sync.WaitGroup
 }
 
 // NewPQueue loads or creates a new PQueue with the given filename.
@@ -28,60 +64,199 @@ type PQueue struct {
 // Specify the required range of priorities; available priorities are from 0 (lowest) to
 // the specified number minus one.
 func NewPQueue(filename string, priorities uint) (*PQueue, error) {
-	if strings.HasSuffix(filename, "/") {
-		filename = fmt.Sprintf("%spq%d.db", filename, time.Now().UnixNano())
-	}
-	db, err := bbolt.Open(filename, 0600, nil)
-	if err != nil {
-		return nil, err
-	}
-	return WrapDB(db, priorities)
+	return NewPQueueWithOptions(filename, priorities, nil)
 }
 
 // WrapDB wraps an existing BoltDB.
 // Specify the required range of priorities; available priorities are from 0 (lowest) to
 // the specified number minus one.
+// If the database is read-only, the queue must already exist in the current format.
 func WrapDB(db *bbolt.DB, priorities uint) (*PQueue, error) {
-	q := &PQueue{false, db, 0, int64(priorities) - 1}
+	return wrapDB(db, nil, priorities)
+}
+
+func wrapDB(db *bbolt.DB, name []byte, priorities uint) (*PQueue, error) {
+	q := &PQueue{
+		conn:        db,
+		name:        name,
+		maxPriority: int64(priorities) - 1,
+		rescheduled: make(chan struct{}, 1),
+		closing:     make(chan struct{}),
+	}
+
 	var err error
-	q.size, err = q.TotalSize()
-	return q, err
+	if db.IsReadOnly() {
+		err = db.View(q.validate)
+	} else {
+		err = db.Update(q.upgrade)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := q.Len()
+	if err != nil {
+		return nil, err
+	}
+	q.size.Store(size)
+
+	if !db.IsReadOnly() {
+		q.background.Add(1)
+		go q.schedule()
+	}
+	return q, nil
+}
+
+// enqueueContext stores a new message, subject to the queue's limits.
+func (b *PQueue) enqueueContext(ctx context.Context, priority uint, message *Message) error {
+	ipri := int64(priority)
+	if ipri > b.maxPriority {
+		return fmt.Errorf("Invalid priority %d on Enqueue", priority)
+	}
+
+	message.stamp(time.Now())
+
+	var key []byte
+	err := b.whenRoom(ctx, func() error {
+		return b.write(func(tx *bbolt.Tx) error {
+			key = nil
+			ok, err := b.makeRoom(tx, 1, int64(len(message.value)))
+			if !ok || err != nil {
+				return err
+			}
+
+			if key, err = b.nextKey(tx); err != nil {
+				return err
+			}
+			return b.put(tx, ipri, key, message)
+		})
+	})
+
+	if err == nil && key != nil {
+		message.key = key
+	}
+	return err
 }
 
+// enqueueMessage stores a message that already has a key.
 func (b *PQueue) enqueueMessage(priority uint, key []byte, message *Message) error {
 	ipri := int64(priority)
 	if ipri > b.maxPriority {
 		return fmt.Errorf("Invalid priority %d on Enqueue", priority)
 	}
-	p := priBytes(ipri, b.maxPriority)
 
-	err1 := b.conn.Update(func(tx *bbolt.Tx) error {
+	message.stamp(time.Now())
 
-		// Get bucket for this priority level
-		pb, err2 := tx.CreateBucketIfNotExists(p)
-		if err2 != nil {
-			return err2
-		}
+	return b.write(func(tx *bbolt.Tx) error {
+		return b.put(tx, ipri, key, message)
+	})
+}
 
-		err2 = pb.Put(key, message.value)
-		if err2 == nil {
-			// note that Bolt Update provides a write lock already (no need for extra sync)
-			b.size += 1
+// write runs a transaction that stores messages, using group commit if enabled.
+// Note that fn may be called more than once so it must be idempotent.
+func (b *PQueue) write(fn func(*bbolt.Tx) error) error {
+	if b.GroupCommit {
+		b.connMu.RLock()
+		defer b.connMu.RUnlock()
+		return b.group.update(b.conn, fn)
+	}
+	return b.update(fn)
+}
+
+// update runs a read-write transaction. Compact may replace the connection, so it is
+// only used while the lock is held.
+func (b *PQueue) update(fn func(*bbolt.Tx) error) error {
+	b.connMu.RLock()
+	defer b.connMu.RUnlock()
+	return b.conn.Update(fn)
+}
+
+// view runs a read-only transaction, as for update.
+func (b *PQueue) view(fn func(*bbolt.Tx) error) error {
+	b.connMu.RLock()
+	defer b.connMu.RUnlock()
+	return b.conn.View(fn)
+}
+
+// put stores a message in the bucket for its priority level, within an Update transaction.
+func (b *PQueue) put(tx *bbolt.Tx, priority int64, key []byte, message *Message) error {
+	// Get bucket for this priority level
+	pb, err := b.createBucket(tx, priBytes(priority, b.maxPriority))
+	if err != nil {
+		return err
+	}
+
+	delta, size := int64(1), int64(len(message.value))
+	if v := pb.Get(key); v != nil {
+		// a message that is overwritten must not be counted twice
+		old, err := decodeMessage(uint(priority), key, v)
+		if err != nil {
+			return err
 		}
-		return err2
-	})
+		if !old.expires.IsZero() {
+			if err = b.unindexExpiry(tx, key, old.expires); err != nil {
+				return err
+			}
+		}
+		delta, size = 0, size-int64(len(old.value))
+	}
+
+	err = pb.Put(key, message.encode())
+	if err != nil {
+		return err
+	}
 
-	return err1
+	if !message.expires.IsZero() {
+		err = b.indexExpiry(tx, priority, key, message.expires)
+	}
+	if err == nil {
+		err = b.count(tx, priority, delta, size)
+	}
+	if err == nil && delta != 0 {
+		// the size only changes if the transaction succeeds
+		tx.OnCommit(b.added)
+	}
+	return err
+}
+
+// added is called after each message has been stored.
+func (b *PQueue) added() {
+	// background goroutines also update the size, so this is atomic
+	b.size.Add(1)
+	b.ready.notify()
+}
+
+// removed is called after each message has been deleted.
+func (b *PQueue) removed() {
+	b.size.Add(-1)
+	b.space.notify()
+}
+
+// dropped accounts for a message that has been deleted from its priority bucket,
+// within an Update transaction.
+func (b *PQueue) dropped(tx *bbolt.Tx, m *Message) error {
+	if !m.expires.IsZero() {
+		if err := b.unindexExpiry(tx, m.key, m.expires); err != nil {
+			return err
+		}
+	}
+	if err := b.count(tx, int64(m.priority), -1, -int64(len(m.value))); err != nil {
+		return err
+	}
+	tx.OnCommit(b.removed)
+	return nil
 }
 
 // Enqueue adds a message to the queue at a specified priority (0=lowest).
+// The message's ID is set when it has been stored. If the queue is full, the
+// Overflow policy applies.
 func (b *PQueue) Enqueue(priority uint, message *Message) error {
-	return b.enqueueMessage(priority, aKey.GetBytes(), message)
+	return b.enqueueContext(context.Background(), priority, message)
 }
 
 // EnqueueValue adds a byte slice value to the queue at a specified priority (0=lowest).
 func (b *PQueue) EnqueueValue(priority uint, value []byte) error {
-	return b.enqueueMessage(priority, aKey.GetBytes(), WrapBytes(value))
+	return b.enqueueContext(context.Background(), priority, WrapBytes(value))
 }
 
 // EnqueueString adds a string value to the queue at a specified priority (0=lowest).
@@ -101,34 +276,70 @@ func (b *PQueue) Requeue(priority uint, message *Message) error {
 }
 
 // Dequeue removes the oldest, highest priority message from the queue and returns it.
+// Any expired messages that would have been returned first are discarded.
 // If there are no messages available, nil, nil will be returned.
 func (b *PQueue) Dequeue() (*Message, error) {
 	var m *Message
 
-	err1 := b.conn.Update(func(tx *bbolt.Tx) error {
+	err := b.update(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		if err := b.housekeep(tx, now); err != nil {
+			return err
+		}
 
-		for pri := b.maxPriority; pri >= 0; pri-- {
-			bucket := tx.Bucket(priBytes(pri, b.maxPriority))
+		var err error
+		m, err = b.take(tx, now)
+		return err
+	})
 
-			if bucket != nil && bucket.Stats().KeyN > 0 {
-				cur := bucket.Cursor()
-				k, v := cur.First() //Should not be empty by definition
-				m = &Message{priority: uint(pri), key: cloneBytes(k), value: cloneBytes(v)}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
 
-				// Remove message
-				if err2 := cur.Delete(); err2 != nil {
-					return err2
-				}
-				// note that Bolt Update provides a write lock already (no need for extra sync)
-				b.size -= 1
-				break
-			}
+// housekeep brings the queue up to date before messages are taken from it.
+func (b *PQueue) housekeep(tx *bbolt.Tx, now time.Time) error {
+	if err := b.promoteDue(tx, now); err != nil {
+		return err
+	}
+	return b.restoreExpiredLeases(tx, now)
+}
+
+// take removes the oldest, highest priority message within an Update transaction and
+// counts it as delivered. Expired messages are discarded along the way.
+// If there are no messages available, the result is nil.
+func (b *PQueue) take(tx *bbolt.Tx, now time.Time) (*Message, error) {
+	for pri, ok := b.nonEmpty(tx, b.maxPriority); ok; pri, ok = b.nonEmpty(tx, pri-1) {
+		bucket := b.bucket(tx, priBytes(pri, b.maxPriority))
+		if bucket == nil {
+			continue
 		}
 
-		return nil
-	})
+		cur := bucket.Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.First() {
+			m, err := decodeMessage(uint(pri), k, v)
+			if err != nil {
+				return nil, err
+			}
+
+			// Remove message
+			if err := cur.Delete(); err != nil {
+				return nil, err
+			}
+			if err := b.dropped(tx, m); err != nil {
+				return nil, err
+			}
 
-	return m, err1
+			if !m.Expired(now) {
+				m.attempts++
+				return m, nil
+			}
+			b.expire(tx, m)
+		}
+	}
+
+	return nil, nil
 }
 
 // DequeueValue removes the oldest, highest priority message from the queue and returns its byte slice.
@@ -150,54 +361,50 @@ func (b *PQueue) DequeueString() (string, error) {
 }
 
 // Size returns the number of entries of a given priority from 0 to 255 (0=highest).
+// It is the same as LenPriority.
 func (b *PQueue) Size(priority uint) (int, error) {
-	ipri := int64(priority)
-	if ipri > b.maxPriority {
+	if int64(priority) > b.maxPriority {
 		return 0, fmt.Errorf("Invalid priority %d for Size()", priority)
 	}
-
-	tx, err := b.conn.Begin(false)
-	if err != nil {
-		return 0, err
-	}
-
-	bucket := tx.Bucket(priBytes(ipri, b.maxPriority))
-	if bucket == nil {
-		return 0, nil
-	}
-
-	count := bucket.Stats().KeyN
-	tx.Rollback()
-
-	return count, nil
+	return b.LenPriority(priority)
 }
 
-// TotalSize sums the sizes of all the priority queues.
+// TotalSize returns the sum of the sizes of all the priority queues. It is the same as Len.
 func (b *PQueue) TotalSize() (int64, error) {
-	var size int64 = 0
-	err := b.conn.View(func(tx *bbolt.Tx) error {
-		for pri := b.maxPriority; pri >= 0; pri-- {
-			p := priBytes(pri, b.maxPriority)
-			bucket := tx.Bucket(p)
-			if bucket != nil {
-				size += int64(bucket.Stats().KeyN)
-			}
-			//fmt.Printf("size after %d = %d\n", pri, size)
-		}
-		return nil
-	})
-	return size, err
+	return b.Len()
 }
 
-// ApproxSize returns the sum of the sizes of all the priority queues, approximately. If the queue size is
-// changing rapidly, this figure will be inaccurate. However, obtaining this value is very quick.
+// ApproxSize returns the sum of the sizes of all the priority queues, approximately. This is
+// kept in memory and updated as each transaction commits, so if the queue size is changing
+// rapidly, this figure may lag slightly. However, obtaining this value is very quick.
 func (b *PQueue) ApproxSize() int64 {
-	return b.size
+	return b.size.Load()
 }
 
-// Close closes the queue database.
+// Close closes the queue database. However, a named queue from OpenQueue shares its
+// database, which is left open, and its messages are kept; use DeleteQueue to remove
+// them. Read-only queues are never deleted. Any unsynced changes are synced before the
+// queue is closed.
 func (b *PQueue) Close() error {
-	if !b.RetainOnClose {
+	b.closeOnce.Do(func() {
+		close(b.closing)
+		b.background.Wait()
+	})
+
+	if b.name != nil {
+		return b.Flush()
+	}
+
+	retain := b.RetainOnClose || b.conn.IsReadOnly()
+
+	if retain {
+		if err := b.Flush(); err != nil {
+			b.conn.Close()
+			return err
+		}
+	}
+
+	if !retain {
 		defer os.Remove(b.conn.Path())
 	}
 	return b.conn.Close()
@@ -210,13 +417,13 @@ func cloneBytes(v []byte) []byte {
 }
 
 func priBytes(priority, max int64) (b []byte) {
-	if max <= 0x100 {
+	if max < 0x100 {
 		b = make([]byte, 1)
 		b[0] = byte(priority)
-	} else if max <= 0x10000 {
+	} else if max < 0x10000 {
 		b = make([]byte, 2)
 		binary.BigEndian.PutUint16(b, uint16(priority))
-	} else if max <= 0x100000000 {
+	} else if max < 0x100000000 {
 		b = make([]byte, 4)
 		binary.BigEndian.PutUint32(b, uint32(priority))
 	} else {
@@ -225,3 +432,17 @@ func priBytes(priority, max int64) (b []byte) {
 	}
 	return
 }
+
+// priFromBytes is the inverse of priBytes.
+func priFromBytes(b []byte) int64 {
+	switch len(b) {
+	case 1:
+		return int64(b[0])
+	case 2:
+		return int64(binary.BigEndian.Uint16(b))
+	case 4:
+		return int64(binary.BigEndian.Uint32(b))
+	default:
+		return int64(binary.BigEndian.Uint64(b))
+	}
+}
@@ -146,6 +146,27 @@ func TestDequeueWide(t *testing.T) {
 	}
 }
 
+func TestHighestPriorityOf257(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 257)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.EnqueueString(zero, "test message 0")
+	testPQueue.EnqueueString(256, "test message 256")
+
+	for _, p := range []uint{256, zero} {
+		mStrComp := fmt.Sprintf("test message %d", p)
+		m, err := testPQueue.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		} else if m.String() != mStrComp || m.Priority() != p {
+			t.Errorf("Expected: \"%s\" at %d, got: \"%s\" at %d", mStrComp, p, m.String(), m.Priority())
+		}
+	}
+}
+
 func TestRequeue(t *testing.T) {
 	testPQueue, err := NewPQueue("./", 256)
 	if err != nil {
@@ -274,6 +295,57 @@ func TestGoroutines(t *testing.T) {
 	}
 }
 
+func TestGroupCommit(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.GroupCommit = true
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+
+	for g := 1; g <= 10; g++ {
+		wg.Add(1)
+		go func() {
+			for n := 1; n <= 10; n++ {
+				err1 := testPQueue.Enqueue(uint(g%5), NewMessagef("test message %d-%d", g, n))
+				if err1 != nil {
+					errs <- err1
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for e := range errs {
+		t.Fatal(e)
+	}
+
+	if s, _ := testPQueue.TotalSize(); s != 100 || testPQueue.ApproxSize() != 100 {
+		t.Errorf("Expected total size 100. Got: %d and %d", s, testPQueue.ApproxSize())
+	}
+
+	// each goroutine's messages stay in order
+	last := make(map[uint]int)
+	for i := 0; i < 100; i++ {
+		m, err := testPQueue.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var g, n int
+		fmt.Sscanf(m.String(), "test message %d-%d", &g, &n)
+		if n <= last[uint(g)] {
+			t.Errorf("Message %q is out of order", m.String())
+		}
+		last[uint(g)] = n
+	}
+}
+
 func TestRetainOnClose(t *testing.T) {
 	testPQueue, err := NewPQueue("testRetain.db", 256)
 	if err != nil {
@@ -328,3 +400,70 @@ func BenchmarkPQueue100(b *testing.B) {
 func BenchmarkPQueue1000(b *testing.B) {
 	benchmarkPQueue(b, 1000)
 }
+
+func benchmarkConcurrentEnqueue(b *testing.B, groupCommit bool) {
+	queue, err := NewPQueue("./", 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer queue.Close()
+
+	queue.GroupCommit = groupCommit
+
+	b.SetParallelism(16)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := queue.EnqueueString(0, "test message"); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkConcurrentEnqueue(b *testing.B) {
+	benchmarkConcurrentEnqueue(b, false)
+}
+
+func BenchmarkConcurrentEnqueueGroupCommit(b *testing.B) {
+	benchmarkConcurrentEnqueue(b, true)
+}
+
+// benchmarkDequeueSparse measures Dequeue when only the lowest priority holds messages,
+// which is the worst case for finding the next message.
+func benchmarkDequeueSparse(b *testing.B, priorities uint) {
+	queue, err := NewPQueue("./", priorities)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer queue.Close()
+
+	// otherwise the disk sync dominates
+	queue.conn.NoSync = true
+
+	values := make([][]byte, b.N)
+	for i := range values {
+		values[i] = []byte("test message")
+	}
+	if err = queue.EnqueueValues(0, values); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if m, err := queue.Dequeue(); m == nil || err != nil {
+			b.Fatal(m, err)
+		}
+	}
+}
+
+func BenchmarkDequeueSparse10(b *testing.B) {
+	benchmarkDequeueSparse(b, 10)
+}
+
+func BenchmarkDequeueSparse1000(b *testing.B) {
+	benchmarkDequeueSparse(b, 1000)
+}
+
+func BenchmarkDequeueSparse65536(b *testing.B) {
+	benchmarkDequeueSparse(b, 65536)
+}
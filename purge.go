@@ -0,0 +1,114 @@
+package boltqueue
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// purgeBatchSize limits how many messages are examined in each transaction when purging,
+// so that clearing a large queue does not need one huge transaction.
+const purgeBatchSize = 1000
+
+// Purge removes all the messages waiting in the queue, returning how many were removed.
+// Scheduled messages, in-flight messages and dead letters are not affected.
+//
+// The messages are removed in a series of transactions, so if an error occurs, some of
+// them may already have been removed.
+func (b *PQueue) Purge() (int, error) {
+	return b.removeWhere(b.maxPriority, 0, nil)
+}
+
+// PurgePriority removes all the messages of a given priority waiting in the queue,
+// returning how many were removed. As with Purge, this uses a series of transactions.
+func (b *PQueue) PurgePriority(priority uint) (int, error) {
+	ipri := int64(priority)
+	if ipri > b.maxPriority {
+		return 0, fmt.Errorf("Invalid priority %d on PurgePriority", priority)
+	}
+	return b.removeWhere(ipri, ipri, nil)
+}
+
+// RemoveWhere removes every message waiting in the queue for which the match function
+// returns true, returning how many were removed. As with Purge, this uses a series of
+// transactions; match is called once for each message and it must not use the queue.
+func (b *PQueue) RemoveWhere(match func(*Message) bool) (int, error) {
+	return b.removeWhere(b.maxPriority, 0, match)
+}
+
+// removeWhere removes the matching messages between two priorities, or all of them if
+// match is nil.
+func (b *PQueue) removeWhere(from, to int64, match func(*Message) bool) (int, error) {
+	count := 0
+	pri := from
+	var after []byte // where to resume within the current priority
+
+	for pri >= to {
+		removed := 0
+		err := b.update(func(tx *bbolt.Tx) error {
+			examined := 0
+			for ; pri >= to; pri, after = pri-1, nil {
+				if after == nil {
+					// skip the empty priorities
+					next, ok := b.nonEmpty(tx, pri)
+					if !ok || next < to {
+						pri = to - 1
+						return nil
+					}
+					pri = next
+				}
+
+				pb := b.bucket(tx, priBytes(pri, b.maxPriority))
+				if pb == nil {
+					continue
+				}
+
+				var doomed []*Message
+				cur := pb.Cursor()
+				k, v := cur.First()
+				if after != nil {
+					k, v = cur.Seek(after)
+					if bytes.Equal(k, after) {
+						k, v = cur.Next()
+					}
+				}
+
+				for ; k != nil && examined < purgeBatchSize; k, v = cur.Next() {
+					m, err := decodeMessage(uint(pri), k, v)
+					if err != nil {
+						return err
+					}
+					if match == nil || match(m) {
+						doomed = append(doomed, m)
+					}
+					after = m.key
+					examined++
+				}
+
+				// deleted after the cursor has finished with the bucket
+				for _, m := range doomed {
+					if err := pb.Delete(m.key); err != nil {
+						return err
+					}
+					if err := b.dropped(tx, m); err != nil {
+						return err
+					}
+				}
+				removed += len(doomed)
+
+				if examined == purgeBatchSize {
+					return nil // resume in a new transaction
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			return count, err
+		}
+		count += removed
+	}
+
+	return count, nil
+}
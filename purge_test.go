@@ -0,0 +1,68 @@
+package boltqueue
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPurge(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	// more than one transaction's worth
+	values := make([][]byte, 2500)
+	for i := range values {
+		values[i] = []byte(fmt.Sprintf("test message %d", i))
+	}
+	testPQueue.EnqueueValues(one, values)
+	testPQueue.EnqueueString(five, "test message 5-1")
+	testPQueue.Enqueue(five, NewMessage("test message 5-2").WithTTL(time.Hour))
+
+	n, err := testPQueue.RemoveWhere(func(m *Message) bool {
+		return strings.HasSuffix(m.String(), "0")
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 250 {
+		t.Errorf("Expected 250 removed. Got: %d", n)
+	}
+
+	m, err := testPQueue.PeekPriority(one, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if m[9].String() != "test message 11" {
+		t.Errorf("Expected: \"%s\", got: \"%s\"", "test message 11", m[9].String())
+	}
+
+	n, err = testPQueue.PurgePriority(five)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("Expected 2 removed. Got: %d", n)
+	}
+
+	size, _ := testPQueue.TotalSize()
+	if size != 2250 || testPQueue.ApproxSize() != 2250 {
+		t.Errorf("Expected total size 2250. Got: %d, approx %d", size, testPQueue.ApproxSize())
+	}
+
+	n, err = testPQueue.Purge()
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 2250 {
+		t.Errorf("Expected 2250 removed. Got: %d", n)
+	}
+
+	if testPQueue.ApproxSize() != 0 {
+		t.Errorf("Expected an empty queue. Got: %d", testPQueue.ApproxSize())
+	}
+
+	if _, err = testPQueue.PurgePriority(10); err == nil {
+		t.Error("Expected an error for an invalid priority")
+	}
+}
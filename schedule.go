@@ -0,0 +1,158 @@
+package boltqueue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// scheduledBucket holds messages that are not yet due. Its keys are the due time followed
+// by the message key, so that due messages are always found at the start.
+var scheduledBucket = []byte("boltqueue.scheduled")
+
+// EnqueueAt adds a message to the queue at a specified priority (0=lowest), but it will not
+// be visible to Dequeue, Size etc until the specified time. Once due, it takes its place
+// among the other messages of that priority according to when it was enqueued.
+func (b *PQueue) EnqueueAt(priority uint, t time.Time, message *Message) error {
+	ipri := int64(priority)
+	if ipri > b.maxPriority {
+		return fmt.Errorf("Invalid priority %d on EnqueueAt", priority)
+	}
+
+	now := time.Now()
+	if !t.After(now) {
+		return b.Enqueue(priority, message)
+	}
+	message.stamp(now)
+
+	var key []byte
+	err := b.write(func(tx *bbolt.Tx) error {
+		sb, err := b.createBucket(tx, scheduledBucket)
+		if err != nil {
+			return err
+		}
+
+		m := *message
+		m.priority = priority
+		if m.key, err = b.nextKey(tx); err != nil {
+			return err
+		}
+		key = m.key
+		return sb.Put(timedKey(t, m.key), encodeEntry(&m))
+	})
+
+	if err == nil {
+		message.key = key
+		b.reschedule()
+	}
+	return err
+}
+
+// EnqueueAfter adds a message to the queue at a specified priority (0=lowest), but it will
+// not be visible to Dequeue, Size etc until the specified delay has elapsed.
+func (b *PQueue) EnqueueAfter(priority uint, delay time.Duration, message *Message) error {
+	return b.EnqueueAt(priority, time.Now().Add(delay), message)
+}
+
+// ScheduledSize returns the number of messages that are not yet due.
+func (b *PQueue) ScheduledSize() (int, error) {
+	count := 0
+	err := b.view(func(tx *bbolt.Tx) error {
+		if sb := b.bucket(tx, scheduledBucket); sb != nil {
+			count = sb.Stats().KeyN
+		}
+		return nil
+	})
+	return count, err
+}
+
+// reschedule wakes the scheduler so that it takes account of a new due time.
+func (b *PQueue) reschedule() {
+	select {
+	case b.rescheduled <- struct{}{}:
+	default: // already pending
+	}
+}
+
+// promoteDue moves all scheduled messages that are due into their priority buckets.
+func (b *PQueue) promoteDue(tx *bbolt.Tx, now time.Time) error {
+	sb := b.bucket(tx, scheduledBucket)
+	if sb == nil {
+		return nil
+	}
+
+	limit := uint64(now.UnixNano())
+	cur := sb.Cursor()
+	for k, v := cur.First(); k != nil && binary.BigEndian.Uint64(k) <= limit; k, v = cur.First() {
+		// the message key follows the due time
+		m, err := decodeEntry(k[8:], v)
+		if err != nil {
+			return err
+		}
+		if err := cur.Delete(); err != nil {
+			return err
+		}
+		if err := b.put(tx, int64(m.priority), m.key, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextDue returns the time when the earliest scheduled message is due or the earliest
+// lease expires, or zero if there are none.
+func (b *PQueue) nextDue() (due time.Time, err error) {
+	err = b.view(func(tx *bbolt.Tx) error {
+		// both buckets have keys that start with a time
+		for _, name := range [][]byte{scheduledBucket, inflightBucket} {
+			if bucket := b.bucket(tx, name); bucket != nil {
+				if k, _ := bucket.Cursor().First(); k != nil {
+					t := time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+					if due.IsZero() || t.Before(due) {
+						due = t
+					}
+				}
+			}
+		}
+		return nil
+	})
+	return due, err
+}
+
+// schedule is the scheduler goroutine, which promotes scheduled messages when they
+// become due and puts back leased messages when their leases expire.
+func (b *PQueue) schedule() {
+	defer b.background.Done()
+
+	for {
+		var timeout <-chan time.Time
+		var timer *time.Timer
+
+		// on error, wait for something to change before retrying
+		due, err := b.nextDue()
+		if err == nil && !due.IsZero() {
+			timer = time.NewTimer(time.Until(due))
+			timeout = timer.C
+		}
+
+		select {
+		case <-b.closing:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+
+		case <-b.rescheduled:
+			if timer != nil {
+				timer.Stop()
+			}
+
+		case <-timeout:
+			b.update(func(tx *bbolt.Tx) error {
+				return b.housekeep(tx, time.Now())
+			})
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package boltqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnqueueAfter(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	err = testPQueue.EnqueueAfter(five, 50*time.Millisecond, NewMessage("later"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testPQueue.EnqueueAt(five, time.Now().Add(-time.Second), NewMessage("now"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, _ := testPQueue.Size(five); s != 1 {
+		t.Errorf("Expected queue size 1 for priority %d. Got: %d", five, s)
+	}
+	if s, _ := testPQueue.ScheduledSize(); s != 1 {
+		t.Errorf("Expected scheduled size 1. Got: %d", s)
+	}
+
+	m, err := testPQueue.DequeueString()
+	if err != nil {
+		t.Error(err)
+	} else if m != "now" {
+		t.Errorf("Expected: \"now\", got: \"%s\"", m)
+	}
+
+	m, err = testPQueue.DequeueString()
+	if err != nil {
+		t.Error(err)
+	} else if m != "" {
+		t.Errorf("Expected nothing, got: \"%s\"", m)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// the scheduler has promoted the message
+	if s, _ := testPQueue.Size(five); s != 1 {
+		t.Errorf("Expected queue size 1 for priority %d. Got: %d", five, s)
+	}
+	if s, _ := testPQueue.ScheduledSize(); s != 0 {
+		t.Errorf("Expected scheduled size 0. Got: %d", s)
+	}
+
+	m, err = testPQueue.DequeueString()
+	if err != nil {
+		t.Error(err)
+	} else if m != "later" {
+		t.Errorf("Expected: \"later\", got: \"%s\"", m)
+	}
+}
+
+func TestIChanScheduled(t *testing.T) {
+	q, err := NewPQueue("./", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ich := NewIChanOf(q)
+	defer ich.Close()
+
+	err = q.EnqueueAfter(zero, 20*time.Millisecond, NewMessage("later"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case v := <-ich.ReceiveEnd():
+		if string(v) != "later" {
+			t.Errorf("Expected: \"later\", got: \"%s\"", string(v))
+		}
+	case <-time.After(time.Second):
+		t.Error("Scheduled message was not delivered")
+	}
+}
@@ -0,0 +1,30 @@
+package boltqueue
+
+import "sync"
+
+// signal is a broadcast notification. Every goroutine waiting on a channel obtained
+// from wait is released by the next call to notify.
+type signal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait returns a channel that will be closed by the next notify. To avoid missing a
+// notification, obtain the channel before checking the condition being waited for.
+func (s *signal) wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil {
+		s.ch = make(chan struct{})
+	}
+	return s.ch
+}
+
+func (s *signal) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch != nil {
+		close(s.ch)
+		s.ch = nil
+	}
+}
@@ -0,0 +1,114 @@
+package boltqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrEmpty is returned by TypedPQueue.Dequeue when there are no messages available.
+var ErrEmpty = errors.New("Queue is empty.")
+
+// DecodeError reports a message that was removed from the queue but could not be decoded.
+// The message is included so that it need not be lost.
+type DecodeError struct {
+	Message *Message
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Cannot decode message: %v", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// TypedPQueue wraps a PQueue so that it holds values of a specific type, which are converted
+// to and from messages using a codec.
+type TypedPQueue[T any] struct {
+	pqueue *PQueue
+	codec  Codec[T]
+}
+
+// NewTypedPQueue loads or creates a queue of values of a specific type. The filename and
+// priorities are used as for NewPQueue.
+func NewTypedPQueue[T any](filename string, priorities uint, codec Codec[T]) (*TypedPQueue[T], error) {
+	pq, err := NewPQueue(filename, priorities)
+	if err != nil {
+		return nil, err
+	}
+	return WrapTypedPQueue(pq, codec), nil
+}
+
+// WrapTypedPQueue wraps a PQueue using a codec.
+func WrapTypedPQueue[T any](pq *PQueue, codec Codec[T]) *TypedPQueue[T] {
+	return &TypedPQueue[T]{pqueue: pq, codec: codec}
+}
+
+// PQueue gets the underlying queue.
+func (q *TypedPQueue[T]) PQueue() *PQueue {
+	return q.pqueue
+}
+
+// Enqueue adds a value to the queue at a specified priority (0=lowest).
+func (q *TypedPQueue[T]) Enqueue(priority uint, value T) error {
+	data, err := q.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return q.pqueue.EnqueueValue(priority, data)
+}
+
+// EnqueueBatch adds several values to the queue at a specified priority (0=lowest), in
+// order, in one transaction.
+func (q *TypedPQueue[T]) EnqueueBatch(priority uint, values []T) error {
+	messages := make([]*Message, len(values))
+	for i, v := range values {
+		data, err := q.codec.Encode(v)
+		if err != nil {
+			return err
+		}
+		messages[i] = WrapBytes(data)
+	}
+	return q.pqueue.EnqueueBatch(priority, messages)
+}
+
+// Dequeue removes the oldest, highest priority value from the queue and returns it.
+// If there are no messages available, ErrEmpty is returned. If the message cannot be
+// decoded, a *DecodeError is returned.
+func (q *TypedPQueue[T]) Dequeue() (T, error) {
+	return q.decode(q.pqueue.Dequeue())
+}
+
+// DequeueWait removes the oldest, highest priority value from the queue and returns it,
+// waiting until one is available if necessary.
+func (q *TypedPQueue[T]) DequeueWait(ctx context.Context) (T, error) {
+	return q.decode(q.pqueue.DequeueWait(ctx))
+}
+
+// Peek returns the value that Dequeue would return next, without removing it.
+func (q *TypedPQueue[T]) Peek() (T, error) {
+	return q.decode(q.pqueue.Peek())
+}
+
+func (q *TypedPQueue[T]) decode(m *Message, err error) (T, error) {
+	var zero T
+	if err != nil {
+		return zero, err
+	}
+	if m == nil {
+		return zero, ErrEmpty
+	}
+
+	v, err := q.codec.Decode(m.value)
+	if err != nil {
+		return zero, &DecodeError{Message: m, Err: err}
+	}
+	return v, nil
+}
+
+// Close closes the underlying queue.
+func (q *TypedPQueue[T]) Close() error {
+	return q.pqueue.Close()
+}
@@ -0,0 +1,65 @@
+package boltqueue
+
+import (
+	"errors"
+	"testing"
+)
+
+type job struct {
+	Name  string
+	Count int
+}
+
+func TestTypedPQueue(t *testing.T) {
+	pq, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, codec := range []Codec[job]{GobCodec[job]{}, JSONCodec[job]{}} {
+		q := WrapTypedPQueue(pq, codec)
+
+		q.Enqueue(one, job{"low", 1})
+		q.EnqueueBatch(five, []job{{"high", 5}, {"higher", 6}})
+
+		for _, expected := range []job{{"high", 5}, {"higher", 6}, {"low", 1}} {
+			v, err := q.Dequeue()
+			if err != nil {
+				t.Error(err)
+			} else if v != expected {
+				t.Errorf("Expected: %+v, got: %+v", expected, v)
+			}
+		}
+
+		_, err = q.Dequeue()
+		if err != ErrEmpty {
+			t.Errorf("Expected ErrEmpty. Got: %v", err)
+		}
+	}
+
+	pq.EnqueueString(one, "not json")
+
+	q := WrapTypedPQueue(pq, JSONCodec[job]{})
+	defer q.Close()
+
+	_, err = q.Dequeue()
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Errorf("Expected a DecodeError. Got: %v", err)
+	} else if de.Message.String() != "not json" {
+		t.Errorf("Expected the undecodable message. Got: \"%s\"", de.Message.String())
+	}
+}
+
+func TestTypedPQueueEncodeError(t *testing.T) {
+	q, err := NewTypedPQueue("./", 10, GobCodec[func()]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	err = q.Enqueue(one, func() {})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
@@ -0,0 +1,92 @@
+package boltqueue
+
+// TypedIChan is a file-backed infinite channel of values of a specific type, which are converted
+// to and from byte slices using a codec. It wraps an IChan.
+type TypedIChan[T any] struct {
+	ichan  *IChan
+	codec  Codec[T]
+	input  chan T
+	output chan T
+}
+
+// NewTypedIChan creates a new file-backed infinite channel of values of a specific type. The
+// filename is used as for NewIChan.
+func NewTypedIChan[T any](filename string, codec Codec[T]) (*TypedIChan[T], error) {
+	ich, err := NewIChan(filename)
+	if err != nil {
+		return nil, err
+	}
+	return WrapTypedIChan(ich, codec), nil
+}
+
+// WrapTypedIChan wraps an IChan using a codec. The IChan should not then be used directly.
+func WrapTypedIChan[T any](ich *IChan, codec Codec[T]) *TypedIChan[T] {
+	c := &TypedIChan[T]{ichan: ich, codec: codec, output: make(chan T)}
+	go c.decode(ich.ReceiveEnd())
+	return c
+}
+
+// SetErrorHandler registers a function to handle errors, which includes values that
+// cannot be encoded at the sending end (when using SendEnd) and messages that cannot be
+// decoded at the receiving end. Decoding errors are *DecodeError. Without a handler,
+// such values are dropped.
+func (c *TypedIChan[T]) SetErrorHandler(eh func(error)) {
+	c.ichan.SetErrorHandler(eh)
+}
+
+// SendEnd gets the input end of the channel. This behaves as for IChan.SendEnd.
+func (c *TypedIChan[T]) SendEnd() chan<- T {
+	if c.input == nil {
+		c.input = make(chan T)
+		raw := c.ichan.SendEnd()
+		go func() {
+			for v := range c.input {
+				data, err := c.codec.Encode(v)
+				if err != nil {
+					c.handle(err)
+				} else {
+					raw <- data
+				}
+			}
+			close(raw)
+		}()
+	}
+	return c.input
+}
+
+// Send sends a value via the channel. This behaves as for IChan.Send.
+func (c *TypedIChan[T]) Send(value T) error {
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return c.ichan.Send(data)
+}
+
+// Close closes the channel and its underlying queue. This behaves as for IChan.Close.
+func (c *TypedIChan[T]) Close() error {
+	return c.ichan.Close()
+}
+
+// ReceiveEnd gets the output end of the channel. This behaves as for IChan.ReceiveEnd.
+func (c *TypedIChan[T]) ReceiveEnd() <-chan T {
+	return c.output
+}
+
+func (c *TypedIChan[T]) decode(raw <-chan []byte) {
+	for data := range raw {
+		v, err := c.codec.Decode(data)
+		if err != nil {
+			c.handle(&DecodeError{Message: WrapBytes(data), Err: err})
+		} else {
+			c.output <- v
+		}
+	}
+	close(c.output)
+}
+
+func (c *TypedIChan[T]) handle(err error) {
+	if c.ichan.eh != nil {
+		c.ichan.eh(err)
+	}
+}
@@ -0,0 +1,53 @@
+package boltqueue
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned by operations that were waiting when the queue was closed.
+var ErrClosed = errors.New("Queue is closed.")
+
+// DequeueWait removes the oldest, highest priority message from the queue and returns it,
+// waiting until one is available if necessary. It is woken by messages being enqueued
+// by this process, by scheduled messages becoming due, or by leases expiring.
+// If the context is cancelled first, its error is returned.
+func (b *PQueue) DequeueWait(ctx context.Context) (*Message, error) {
+	for {
+		// obtained beforehand so that no enqueues are missed
+		ready := b.ready.wait()
+
+		m, err := b.Dequeue()
+		if m != nil || err != nil {
+			return m, err
+		}
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-b.closing:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// DequeueValueWait removes the oldest, highest priority message from the queue and returns its
+// byte slice, waiting until one is available if necessary.
+func (b *PQueue) DequeueValueWait(ctx context.Context) ([]byte, error) {
+	m, err := b.DequeueWait(ctx)
+	if m == nil || err != nil {
+		return nil, err
+	}
+	return m.value, nil
+}
+
+// DequeueStringWait removes the oldest, highest priority message from the queue and returns its
+// value as a string, waiting until one is available if necessary.
+func (b *PQueue) DequeueStringWait(ctx context.Context) (string, error) {
+	m, err := b.DequeueWait(ctx)
+	if m == nil || err != nil {
+		return "", err
+	}
+	return string(m.value), nil
+}
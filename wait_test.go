@@ -0,0 +1,89 @@
+package boltqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDequeueWait(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		testPQueue.EnqueueString(five, "test message 5")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	m, err := testPQueue.DequeueStringWait(ctx)
+	if err != nil {
+		t.Error(err)
+	} else if m != "test message 5" {
+		t.Errorf("Expected: \"%s\", got: \"%s\"", "test message 5", m)
+	}
+}
+
+func TestDequeueWaitCancelled(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	m, err := testPQueue.DequeueWait(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded. Got: %v", err)
+	}
+	if m != nil {
+		t.Errorf("Expected no message. Got: \"%s\"", m.String())
+	}
+}
+
+func TestDequeueWaitClosed(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		testPQueue.Close()
+	}()
+
+	_, err = testPQueue.DequeueWait(context.Background())
+	if err != ErrClosed {
+		t.Errorf("Expected ErrClosed. Got: %v", err)
+	}
+}
+
+func TestDequeueWaitLeaseExpires(t *testing.T) {
+	testPQueue, err := NewPQueue("./", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testPQueue.Close()
+
+	testPQueue.EnqueueString(five, "test message 5")
+	if _, err = testPQueue.DequeueLease(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	m, err := testPQueue.DequeueWait(ctx)
+	if err != nil {
+		t.Error(err)
+	} else if m.String() != "test message 5" {
+		t.Errorf("Expected: \"%s\", got: \"%s\"", "test message 5", m.String())
+	}
+}